@@ -8,7 +8,7 @@ import (
 
 func addMigrateCommand(rootCmd *cobra.Command, logger logs.Logger) {
 	var path string
-	var limit int64
+	opts := commands.RunOptions{}
 	cmd := &cobra.Command{
 		Use:   "migrate",
 		Short: "Run migrations",
@@ -16,7 +16,7 @@ func addMigrateCommand(rootCmd *cobra.Command, logger logs.Logger) {
 		Args:  cobra.MaximumNArgs(2),
 		Run: func(cmd *cobra.Command, args []string) {
 			logger.Infof("Migration path: '%v'", path)
-			err := commands.Migrate(path, limit, logger)
+			err := commands.Migrate(path, &opts, logger)
 			if err != nil {
 				panic(err)
 			}
@@ -24,6 +24,11 @@ func addMigrateCommand(rootCmd *cobra.Command, logger logs.Logger) {
 	}
 
 	cmd.Flags().StringVarP(&path, "path", "t", "./changelog.json", "full path to migrations' map. Default: ./changelog.json")
-	cmd.Flags().Int64VarP(&limit, "count", "c", -1, "limit amount of changes applied in a run. Values equal or below 0 are treated as 'apply everything'. Default: -1")
+	cmd.Flags().Int64VarP(&opts.Limit, "count", "c", -1, "limit amount of changes applied in a run. Values equal or below 0 are treated as 'apply everything'. Default: -1")
+	cmd.Flags().DurationVarP(&opts.WaitForLock, "wait-for-lock", "w", 0, "how long to wait for a migration lock held by another run, e.g. 5m. Default: 0 (fail immediately)")
+	cmd.Flags().BoolVarP(&opts.DryRun, "dry-run", "d", false, "print commands, that would be executed, instead of executing them. Default: false")
+	cmd.Flags().StringVarP(&opts.DryRunOutput, "dry-run-output", "o", "", "file to write dry-run commands into. Default: stdout")
+	cmd.Flags().StringVarP(&opts.Contexts, "contexts", "x", "", "expression to select change sets by contexts and labels, e.g. 'dev and !perf'. Default: every change set")
+	addPropertiesFlags(cmd, &opts)
 	rootCmd.AddCommand(cmd)
 }
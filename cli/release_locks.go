@@ -0,0 +1,28 @@
+package cli
+
+import (
+	"github.com/coldze/mongol/commands"
+	"github.com/coldze/primitives/logs"
+	"github.com/spf13/cobra"
+)
+
+func addReleaseLocksCommand(rootCmd *cobra.Command, logger logs.Logger) {
+	var path string
+	opts := commands.RunOptions{}
+	cmd := &cobra.Command{
+		Use:   "release-locks",
+		Short: "Force-release migration locks",
+		Long:  "Force-release migration locks, left by crashed or stale migration runs",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			logger.Infof("Migration path: '%v'", path)
+			err := commands.ReleaseLocks(path, &opts, logger)
+			if err != nil {
+				panic(err)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&path, "path", "t", "./changelog.json", "full path to migrations' map. Default: ./changelog.json")
+	addPropertiesFlags(cmd, &opts)
+	rootCmd.AddCommand(cmd)
+}
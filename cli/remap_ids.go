@@ -0,0 +1,29 @@
+package cli
+
+import (
+	"github.com/coldze/mongol/commands"
+	"github.com/coldze/primitives/logs"
+	"github.com/spf13/cobra"
+)
+
+func addRemapIDsCommand(rootCmd *cobra.Command, logger logs.Logger) {
+	var path string
+	opts := commands.RunOptions{}
+	cmd := &cobra.Command{
+		Use:   "remap-ids",
+		Short: "Remap positional change IDs to explicit ones",
+		Long:  "Rewrite migrations log records with positional change IDs (<id>_transaction_entry_<index>) to the explicit IDs, specified in migration changelogs",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			logger.Infof("Migration path: '%v'", path)
+			err := commands.RemapIDs(path, &opts, logger)
+			if err != nil {
+				panic(err)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&path, "path", "t", "./changelog.json", "full path to migrations' map. Default: ./changelog.json")
+	cmd.Flags().DurationVarP(&opts.WaitForLock, "wait-for-lock", "w", 0, "how long to wait for a migration lock held by another run, e.g. 5m. Default: 0 (fail immediately)")
+	addPropertiesFlags(cmd, &opts)
+	rootCmd.AddCommand(cmd)
+}
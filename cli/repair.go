@@ -0,0 +1,33 @@
+package cli
+
+import (
+	"github.com/coldze/mongol/commands"
+	"github.com/coldze/primitives/logs"
+	"github.com/spf13/cobra"
+)
+
+func addRepairCommand(rootCmd *cobra.Command, logger logs.Logger) {
+	var path string
+	var changeID string
+	var resolution string
+	opts := commands.RunOptions{}
+	cmd := &cobra.Command{
+		Use:   "repair",
+		Short: "Resolve unfinished changes",
+		Long:  "List changes, left in-progress or failed by interrupted runs, and resolve them as applied or not-applied after checking the database",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			logger.Infof("Migration path: '%v'", path)
+			err := commands.Repair(path, changeID, resolution, &opts, logger)
+			if err != nil {
+				panic(err)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&path, "path", "t", "./changelog.json", "full path to migrations' map. Default: ./changelog.json")
+	cmd.Flags().StringVarP(&changeID, "change-id", "i", "", "ID of unfinished change to resolve. Default: every unfinished change")
+	cmd.Flags().StringVarP(&resolution, "resolve", "s", "", "resolve unfinished changes: 'applied' - interrupted migrate or rollback took effect, 'not-applied' - it didn't. Default: only list unfinished changes")
+	cmd.Flags().DurationVarP(&opts.WaitForLock, "wait-for-lock", "w", 0, "how long to wait for a migration lock held by another run, e.g. 5m. Default: 0 (fail immediately)")
+	addPropertiesFlags(cmd, &opts)
+	rootCmd.AddCommand(cmd)
+}
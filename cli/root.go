@@ -3,6 +3,7 @@ package cli
 import (
 	"fmt"
 
+	"github.com/coldze/mongol/commands"
 	"github.com/coldze/primitives/custom_error"
 	"github.com/coldze/primitives/logs"
 	"github.com/spf13/cobra"
@@ -38,6 +39,11 @@ func (c *Cli) Run() (result error) {
 	return c.rootCommand.Execute()
 }
 
+func addPropertiesFlags(cmd *cobra.Command, opts *commands.RunOptions) {
+	cmd.Flags().StringArrayVarP(&opts.Properties, "property", "p", []string{}, "property to substitute into ${name} references in changelogs and migrations, in format key=value. Can be repeated")
+	cmd.Flags().StringVarP(&opts.PropertiesFile, "properties-file", "r", "", "file with properties in format key=value, one per line")
+}
+
 func NewCliApp(logger logs.Logger) App {
 
 	rootCmd := &cobra.Command{
@@ -48,6 +54,13 @@ func NewCliApp(logger logs.Logger) App {
 
 	addMigrateCommand(rootCmd, logger)
 	addRollbackCommand(rootCmd, logger)
+	addStatusCommand(rootCmd, logger)
+	addTagCommand(rootCmd, logger)
+	addRemapIDsCommand(rootCmd, logger)
+	addReleaseLocksCommand(rootCmd, logger)
+	addRepairCommand(rootCmd, logger)
+	addValidateCommand(rootCmd, logger)
+	addUpgradeChecksumsCommand(rootCmd, logger)
 
 	return &Cli{
 		rootCommand: rootCmd,
@@ -0,0 +1,31 @@
+package cli
+
+import (
+	"github.com/coldze/mongol/commands"
+	"github.com/coldze/primitives/logs"
+	"github.com/spf13/cobra"
+)
+
+func addStatusCommand(rootCmd *cobra.Command, logger logs.Logger) {
+	var path string
+	var failOnPending bool
+	opts := commands.RunOptions{}
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show state of migrations",
+		Long:  "List every change with its state: applied, pending, reapply, checksum-mismatch, in-progress or failed",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			logger.Infof("Migration path: '%v'", path)
+			err := commands.Status(path, failOnPending, &opts, logger)
+			if err != nil {
+				panic(err)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&path, "path", "t", "./changelog.json", "full path to migrations' map. Default: ./changelog.json")
+	cmd.Flags().BoolVarP(&failOnPending, "fail-on-pending", "f", false, "exit with non-zero code if there are pending, unfinished changes or changes with checksum mismatch. Default: false")
+	cmd.Flags().StringVarP(&opts.Contexts, "contexts", "x", "", "expression to select change sets by contexts and labels, e.g. 'dev and !perf'. Default: every change set")
+	addPropertiesFlags(cmd, &opts)
+	rootCmd.AddCommand(cmd)
+}
@@ -0,0 +1,30 @@
+package cli
+
+import (
+	"github.com/coldze/mongol/commands"
+	"github.com/coldze/primitives/logs"
+	"github.com/spf13/cobra"
+)
+
+func addValidateCommand(rootCmd *cobra.Command, logger logs.Logger) {
+	var path string
+	var strict bool
+	opts := commands.RunOptions{}
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Validate changelogs offline",
+		Long:  "Load every changelog and migration without connecting to database and report all problems found: unresolved includes, invalid migrations, duplicated change set IDs, unknown commands and empty rollbacks",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			logger.Infof("Migration path: '%v'", path)
+			err := commands.Validate(path, strict, &opts, logger)
+			if err != nil {
+				panic(err)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&path, "path", "t", "./changelog.json", "full path to migrations' map. Default: ./changelog.json")
+	cmd.Flags().BoolVarP(&strict, "strict", "s", false, "treat warnings (e.g. empty rollbacks) as errors. Default: false")
+	addPropertiesFlags(cmd, &opts)
+	rootCmd.AddCommand(cmd)
+}
@@ -9,8 +9,12 @@ import (
 	"github.com/coldze/primitives/logs"
 )
 
-func Migrate(path string, limit int64, log logs.Logger) custom_error.CustomError {
-	changeLog, errValue := engine.NewChangeLog(path)
+func Migrate(path string, opts *RunOptions, log logs.Logger) custom_error.CustomError {
+	properties, errValue := newProperties(opts)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to load properties.")
+	}
+	changeLog, errValue := engine.NewChangeLog(path, properties)
 	if errValue != nil {
 		return custom_error.NewErrorf(errValue, "Failed to load changelog.")
 	}
@@ -23,6 +27,17 @@ func Migrate(path string, limit int64, log logs.Logger) custom_error.CustomError
 	defer mongoClient.Disconnect(ctx)
 	db := mongoClient.Database(changeLog.GetDBName())
 
+	lock, errValue := lockDatabase(ctx, db, opts, log)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to lock database.")
+	}
+	defer unlock(lock, log)
+
+	errValue = checkUnfinished(ctx, db)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Unfinished changes found.")
+	}
+
 	notAppliedList := map[string]struct{}{}
 	appliedList := map[string]struct{}{}
 
@@ -57,33 +72,64 @@ func Migrate(path string, limit int64, log logs.Logger) custom_error.CustomError
 		return nil
 	}
 
-	validator, errValue := mongo.NewMongoChangeSetValidator(db, engine.COLLECTION_NAME_MIGRATIONS_LOG, appliedProcessing, notAppliedProcessing)
+	reapplyList := map[string]struct{}{}
+	reapplyProcessing := func(changeID string) custom_error.CustomError {
+		log.Infof("Change with ID %v will be applied again", changeID)
+		_, ok := reapplyList[changeID]
+		if ok {
+			return custom_error.MakeErrorf("Dublicated change id: %v", changeID)
+		}
+		reapplyList[changeID] = struct{}{}
+		return nil
+	}
+
+	validator, errValue := mongo.NewMongoChangeSetValidator(db, engine.COLLECTION_NAME_MIGRATIONS_LOG, appliedProcessing, notAppliedProcessing, reapplyProcessing)
 	if errValue != nil {
 		return custom_error.NewErrorf(errValue, "Failed to create validator.")
 	}
+	validator, errValue = engine.NewContextFilter(opts.Contexts, validator)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to create context filter.")
+	}
 
 	errValue = changeLog.Apply(validator)
 	if errValue != nil {
 		return custom_error.NewErrorf(errValue, "Changelog validation failed.")
 	}
 
-	documentApplier := mongo.NewDbChanger(db, context.Background())
-	transactionRecFactory := engine.NewTransactionRecordFactory(engine.COLLECTION_NAME_MIGRATIONS_LOG)
+	documentApplier, closeApplier, errValue := newDocumentApplier(ctx, db, opts)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to create document applier.")
+	}
+	defer closeApplier()
+	journalRecFactory := engine.NewJournalRecordFactory(engine.COLLECTION_NAME_MIGRATIONS_LOG, engine.JOURNAL_OPERATION_MIGRATE)
+	transactionRecFactory := engine.NewTransactionRecordFactory(engine.COLLECTION_NAME_MIGRATIONS_LOG, opts.Contexts)
+	revertRecFactory := engine.NewRollbackTransactionRecordFactory(engine.COLLECTION_NAME_MIGRATIONS_LOG)
 
-	transactionFactory, errValue := engine.NewSimulatedTransactionFactory(documentApplier, transactionRecFactory, appliedList, limit, log)
+	runInSession, errValue := newSessionRunner(ctx, db, opts, log)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to create session runner.")
+	}
+
+	transactionFactory, errValue := engine.NewTransactionFactory(documentApplier, runInSession, transactionRecFactory, revertRecFactory, journalRecFactory, appliedList, opts.Limit, log)
 	if errValue != nil {
 		return custom_error.NewErrorf(errValue, "Failed to create transaction factory.")
 	}
 	if transactionFactory == nil {
 		return custom_error.MakeErrorf("Empty Transaction-factory created.")
 	}
-	applier, errValue := engine.NewChangeSetApplier(transactionFactory)
+	transactionFactory = engine.NewLockedTransactionFactory(transactionFactory, lock.Lost())
+	applier, errValue := engine.NewChangeSetApplier(transactionFactory, mongo.NewPreconditionChecker(ctx, db), appliedList, log)
 	if errValue != nil {
 		return custom_error.NewErrorf(errValue, "Failed to create migration applier.")
 	}
 	if applier == nil {
 		return custom_error.MakeErrorf("Empty Migration-applier created.")
 	}
+	applier, errValue = engine.NewContextFilter(opts.Contexts, applier)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to create context filter.")
+	}
 
 	errValue = changeLog.Apply(applier)
 	if errValue != nil {
@@ -0,0 +1,17 @@
+package commands
+
+import (
+	"time"
+)
+
+type RunOptions struct {
+	Limit          int64
+	WaitForLock    time.Duration
+	DryRun         bool
+	DryRunOutput   string
+	ToTag          string
+	ToDate         string
+	Contexts       string
+	Properties     []string
+	PropertiesFile string
+}
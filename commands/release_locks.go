@@ -0,0 +1,36 @@
+package commands
+
+import (
+	"context"
+
+	"github.com/coldze/mongol/engine"
+	"github.com/coldze/mongol/primitives/mongo"
+	"github.com/coldze/primitives/custom_error"
+	"github.com/coldze/primitives/logs"
+)
+
+func ReleaseLocks(path string, opts *RunOptions, log logs.Logger) custom_error.CustomError {
+	properties, errValue := newProperties(opts)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to load properties.")
+	}
+	settings, errValue := engine.NewConnectionSettings(path, properties)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to read changelog.")
+	}
+	ctx := context.Background()
+
+	mongoClient, err := newMgoClient(ctx, settings.GetConnectionString())
+	if err != nil {
+		return custom_error.NewErrorf(err, "Failed to connect to mongo.")
+	}
+	defer mongoClient.Disconnect(ctx)
+	db := mongoClient.Database(settings.GetDBName())
+
+	released, errValue := mongo.ReleaseLocks(ctx, db)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to release locks.")
+	}
+	log.Infof("Released locks: %v", released)
+	return nil
+}
@@ -0,0 +1,63 @@
+package commands
+
+import (
+	"context"
+
+	"github.com/coldze/mongol/engine"
+	"github.com/coldze/mongol/primitives/mongo"
+	"github.com/coldze/primitives/custom_error"
+	"github.com/coldze/primitives/logs"
+)
+
+func RemapIDs(path string, opts *RunOptions, log logs.Logger) custom_error.CustomError {
+	properties, errValue := newProperties(opts)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to load properties.")
+	}
+	changeLog, errValue := engine.NewChangeLog(path, properties)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to load changelog.")
+	}
+	ctx := context.Background()
+
+	mongoClient, err := newMgoClient(ctx, changeLog.GetConnectionString())
+	if err != nil {
+		return custom_error.NewErrorf(err, "Failed to connect to mongo.")
+	}
+	defer mongoClient.Disconnect(ctx)
+	db := mongoClient.Database(changeLog.GetDBName())
+
+	lock, errValue := lockDatabase(ctx, db, opts, log)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to lock database.")
+	}
+	defer unlock(lock, log)
+
+	remapped := 0
+	skipped := 0
+	for _, changeSet := range changeLog.GetChangeSets() {
+		for _, change := range changeSet.Changes {
+			if change.ID == change.LegacyID {
+				continue
+			}
+			hashes := []string{change.Hash}
+			if len(change.LegacyHash) > 0 {
+				hashes = append(hashes, change.LegacyHash)
+			}
+			result, errValue := mongo.RemapChangeID(ctx, db, engine.COLLECTION_NAME_MIGRATIONS_LOG, change.LegacyID, change.ID, hashes)
+			if errValue != nil {
+				return custom_error.NewErrorf(errValue, "Failed to remap change '%v'.", change.LegacyID)
+			}
+			switch result {
+			case mongo.REMAP_RESULT_REMAPPED:
+				log.Infof("Change '%v' remapped to '%v'", change.LegacyID, change.ID)
+				remapped++
+			case mongo.REMAP_RESULT_CHECKSUM_MISMATCH:
+				log.Warningf("Change '%v' is not remapped to '%v': recorded checksum differs, record belongs to another change. Check changes, inserted before it", change.LegacyID, change.ID)
+				skipped++
+			}
+		}
+	}
+	log.Infof("Remapped changes: %v. Skipped: %v", remapped, skipped)
+	return nil
+}
@@ -0,0 +1,93 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/coldze/mongol/engine"
+	"github.com/coldze/mongol/primitives/mongo"
+	"github.com/coldze/primitives/custom_error"
+	"github.com/coldze/primitives/logs"
+)
+
+const (
+	REPAIR_RESOLVE_APPLIED     = "applied"
+	REPAIR_RESOLVE_NOT_APPLIED = "not-applied"
+)
+
+func printUnfinished(records []*mongo.ChangeRecord) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "CHANGE\tOPERATION\tSTATE\tERROR")
+	for _, record := range records {
+		fmt.Fprintf(writer, "%v\t%v\t%v\t%v\n", record.ID, record.Operation, record.State, record.Error)
+	}
+	writer.Flush()
+}
+
+func selectUnfinished(records []*mongo.ChangeRecord, changeID string) ([]*mongo.ChangeRecord, custom_error.CustomError) {
+	if len(changeID) <= 0 {
+		return records, nil
+	}
+	for _, record := range records {
+		if record.ID == changeID {
+			return []*mongo.ChangeRecord{record}, nil
+		}
+	}
+	return nil, custom_error.MakeErrorf("Change '%v' has no unfinished record", changeID)
+}
+
+func Repair(path string, changeID string, resolution string, opts *RunOptions, log logs.Logger) custom_error.CustomError {
+	if len(resolution) > 0 && resolution != REPAIR_RESOLVE_APPLIED && resolution != REPAIR_RESOLVE_NOT_APPLIED {
+		return custom_error.MakeErrorf("Unknown resolution '%v'. Expected '%v' or '%v'", resolution, REPAIR_RESOLVE_APPLIED, REPAIR_RESOLVE_NOT_APPLIED)
+	}
+	properties, errValue := newProperties(opts)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to load properties.")
+	}
+	settings, errValue := engine.NewConnectionSettings(path, properties)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to read changelog.")
+	}
+	ctx := context.Background()
+
+	mongoClient, err := newMgoClient(ctx, settings.GetConnectionString())
+	if err != nil {
+		return custom_error.NewErrorf(err, "Failed to connect to mongo.")
+	}
+	defer mongoClient.Disconnect(ctx)
+	db := mongoClient.Database(settings.GetDBName())
+
+	lock, errValue := lockDatabase(ctx, db, opts, log)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to lock database.")
+	}
+	defer unlock(lock, log)
+
+	records, errValue := mongo.GetUnfinished(ctx, db, engine.COLLECTION_NAME_MIGRATIONS_LOG)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to get unfinished changes.")
+	}
+	records, errValue = selectUnfinished(records, changeID)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to select changes to repair.")
+	}
+	if len(records) <= 0 {
+		log.Infof("No unfinished changes found.")
+		return nil
+	}
+	if len(resolution) <= 0 {
+		printUnfinished(records)
+		log.Infof("Unfinished changes: %v. Check database and resolve them with --resolve=%v or --resolve=%v.", len(records), REPAIR_RESOLVE_APPLIED, REPAIR_RESOLVE_NOT_APPLIED)
+		return nil
+	}
+	for _, record := range records {
+		errValue = mongo.ResolveUnfinished(ctx, db, engine.COLLECTION_NAME_MIGRATIONS_LOG, record, resolution == REPAIR_RESOLVE_APPLIED)
+		if errValue != nil {
+			return custom_error.NewErrorf(errValue, "Failed to repair change '%v'.", record.ID)
+		}
+		log.Infof("Change '%v' (%v, %v) resolved as %v", record.ID, record.Operation, record.State, resolution)
+	}
+	return nil
+}
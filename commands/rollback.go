@@ -2,15 +2,80 @@ package commands
 
 import (
 	"context"
+	"time"
 
 	"github.com/coldze/mongol/engine"
 	"github.com/coldze/mongol/primitives/mongo"
 	"github.com/coldze/primitives/custom_error"
 	"github.com/coldze/primitives/logs"
+	mgo "go.mongodb.org/mongo-driver/mongo"
 )
 
-func Rollback(path string, limit int64, log logs.Logger) custom_error.CustomError {
-	changeLog, errValue := engine.NewRollbackChangeLog(path)
+// rollbackSelection is parsed from 'count', 'to-tag' and 'to-date' options. Without any of them every applied change
+// is rolled back.
+type rollbackSelection struct {
+	tag   string
+	date  time.Time
+	count int64
+}
+
+func parseRollbackSelection(opts *RunOptions) (*rollbackSelection, custom_error.CustomError) {
+	selectors := 0
+	if len(opts.ToTag) > 0 {
+		selectors++
+	}
+	if len(opts.ToDate) > 0 {
+		selectors++
+	}
+	if opts.Limit > 0 {
+		selectors++
+	}
+	if selectors > 1 {
+		return nil, custom_error.MakeErrorf("Only one of 'count', 'to-tag' and 'to-date' can be specified")
+	}
+	selection := &rollbackSelection{
+		tag: opts.ToTag,
+	}
+	if len(opts.ToDate) > 0 {
+		date, err := time.Parse(time.RFC3339, opts.ToDate)
+		if err != nil {
+			return nil, custom_error.MakeErrorf("Failed to parse date '%v'. Expected RFC3339 format. Error: %v", opts.ToDate, err)
+		}
+		selection.date = date
+	}
+	if opts.Limit > 0 {
+		selection.count = opts.Limit
+	}
+	return selection, nil
+}
+
+func getChangesToRollback(ctx context.Context, db *mgo.Database, opts *RunOptions, appliedList map[string]struct{}, log logs.Logger) (map[string]struct{}, custom_error.CustomError) {
+	selection, errValue := parseRollbackSelection(opts)
+	if errValue != nil {
+		return nil, errValue
+	}
+	if len(selection.tag) > 0 {
+		log.Infof("Rolling back changes applied after tag '%v'", selection.tag)
+		return mongo.GetAppliedAfterTag(ctx, db, engine.COLLECTION_NAME_MIGRATIONS_LOG, selection.tag)
+	}
+	if !selection.date.IsZero() {
+		log.Infof("Rolling back changes applied after %v", selection.date)
+		return mongo.GetAppliedAfter(ctx, db, engine.COLLECTION_NAME_MIGRATIONS_LOG, selection.date)
+	}
+	if selection.count > 0 {
+		log.Infof("Rolling back last %v applied changes", selection.count)
+		return mongo.GetLastApplied(ctx, db, engine.COLLECTION_NAME_MIGRATIONS_LOG, selection.count, appliedList)
+	}
+	log.Infof("Rolling back all applied changes")
+	return nil, nil
+}
+
+func Rollback(path string, opts *RunOptions, log logs.Logger) custom_error.CustomError {
+	properties, errValue := newProperties(opts)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to load properties.")
+	}
+	changeLog, errValue := engine.NewRollbackChangeLog(path, properties)
 	if errValue != nil {
 		return custom_error.NewErrorf(errValue, "Failed to load changelog.")
 	}
@@ -22,6 +87,17 @@ func Rollback(path string, limit int64, log logs.Logger) custom_error.CustomErro
 	defer mongoClient.Disconnect(ctx)
 	db := mongoClient.Database(changeLog.GetDBName())
 
+	lock, errValue := lockDatabase(ctx, db, opts, log)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to lock database.")
+	}
+	defer unlock(lock, log)
+
+	errValue = checkUnfinished(ctx, db)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Unfinished changes found.")
+	}
+
 	notAppliedList := map[string]struct{}{}
 	appliedList := map[string]struct{}{}
 
@@ -52,26 +128,48 @@ func Rollback(path string, limit int64, log logs.Logger) custom_error.CustomErro
 		return nil
 	}
 
-	validator, errValue := mongo.NewMongoChangeSetValidator(db, engine.COLLECTION_NAME_MIGRATIONS_LOG, appliedProcessing, notAppliedProcessing)
+	validator, errValue := mongo.NewMongoChangeSetValidator(db, engine.COLLECTION_NAME_MIGRATIONS_LOG, appliedProcessing, notAppliedProcessing, appliedProcessing)
 	if errValue != nil {
 		return custom_error.NewErrorf(errValue, "Failed to create validator.")
 	}
+	validator, errValue = engine.NewContextFilter(opts.Contexts, validator)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to create context filter.")
+	}
 
 	errValue = changeLog.Apply(validator)
 	if errValue != nil {
 		return custom_error.NewErrorf(errValue, "Changelog validation failed.")
 	}
 
-	documentApplier := mongo.NewDbChanger(db, context.Background())
+	toRollback, errValue := getChangesToRollback(ctx, db, opts, appliedList, log)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to get changes to rollback.")
+	}
+	skipList := excludeChanges(appliedList, notAppliedList, toRollback)
+
+	documentApplier, closeApplier, errValue := newDocumentApplier(ctx, db, opts)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to create document applier.")
+	}
+	defer closeApplier()
+	journalRecFactory := engine.NewJournalRecordFactory(engine.COLLECTION_NAME_MIGRATIONS_LOG, engine.JOURNAL_OPERATION_ROLLBACK)
 	transactionRecFactory := engine.NewRollbackTransactionRecordFactory(engine.COLLECTION_NAME_MIGRATIONS_LOG)
+	revertRecFactory := engine.NewTransactionRecordFactory(engine.COLLECTION_NAME_MIGRATIONS_LOG, opts.Contexts)
+
+	runInSession, errValue := newSessionRunner(ctx, db, opts, log)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to create session runner.")
+	}
 
-	transactionFactory, errValue := engine.NewRollbackSimulatedTransactionFactory(documentApplier, transactionRecFactory, notAppliedList, limit, log)
+	transactionFactory, errValue := engine.NewRollbackTransactionFactory(documentApplier, runInSession, transactionRecFactory, revertRecFactory, journalRecFactory, skipList, -1, log)
 	if errValue != nil {
 		return custom_error.NewErrorf(errValue, "Failed to create transaction factory.")
 	}
 	if transactionFactory == nil {
 		return custom_error.MakeErrorf("Empty Transaction-factory created.")
 	}
+	transactionFactory = engine.NewLockedTransactionFactory(transactionFactory, lock.Lost())
 	applier, errValue := engine.NewRollbackChangeSetApplier(transactionFactory)
 	if errValue != nil {
 		return custom_error.NewErrorf(errValue, "Failed to create migration applier.")
@@ -79,6 +177,15 @@ func Rollback(path string, limit int64, log logs.Logger) custom_error.CustomErro
 	if applier == nil {
 		return custom_error.MakeErrorf("Empty Migration-applier created.")
 	}
+	markedRan, errValue := mongo.GetMarkedRan(ctx, db, engine.COLLECTION_NAME_MIGRATIONS_LOG)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to get changes marked as ran.")
+	}
+	applier = engine.NewMarkedRanFilter(markedRan, applier)
+	applier, errValue = engine.NewContextFilter(opts.Contexts, applier)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to create context filter.")
+	}
 
 	/*notAppliedChangeLog, customErr := engine.NewArrayChangeLog(notAppliedList)
 	if customErr != nil {
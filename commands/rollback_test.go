@@ -0,0 +1,42 @@
+package commands
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRollbackSelection(t *testing.T) {
+	cases := []struct {
+		name     string
+		opts     RunOptions
+		expected *rollbackSelection
+		err      string
+	}{
+		{"everything", RunOptions{Limit: -1}, &rollbackSelection{}, ""},
+		{"zero count", RunOptions{Limit: 0}, &rollbackSelection{}, ""},
+		{"count", RunOptions{Limit: 2}, &rollbackSelection{count: 2}, ""},
+		{"tag", RunOptions{Limit: -1, ToTag: "release_1.2"}, &rollbackSelection{tag: "release_1.2"}, ""},
+		{"date", RunOptions{Limit: -1, ToDate: "2019-01-01T10:00:00+02:00"}, &rollbackSelection{date: time.Date(2019, 1, 1, 8, 0, 0, 0, time.UTC)}, ""},
+		{"invalid date", RunOptions{Limit: -1, ToDate: "2019-01-01"}, nil, "Failed to parse date '2019-01-01'"},
+		{"tag and count", RunOptions{Limit: 2, ToTag: "release_1.2"}, nil, "Only one of 'count', 'to-tag' and 'to-date'"},
+		{"tag and date", RunOptions{Limit: -1, ToTag: "release_1.2", ToDate: "2019-01-01T00:00:00Z"}, nil, "Only one of 'count', 'to-tag' and 'to-date'"},
+		{"count and date", RunOptions{Limit: 1, ToDate: "2019-01-01T00:00:00Z"}, nil, "Only one of 'count', 'to-tag' and 'to-date'"},
+	}
+	for _, c := range cases {
+		selection, err := parseRollbackSelection(&c.opts)
+		if len(c.err) > 0 {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%v: expected error with '%v', got: %v", c.name, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", c.name, err)
+			continue
+		}
+		if selection.tag != c.expected.tag || selection.count != c.expected.count || !selection.date.Equal(c.expected.date) {
+			t.Errorf("%v: expected %+v, got %+v", c.name, c.expected, selection)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/coldze/mongol/engine"
+	"github.com/coldze/mongol/primitives/mongo"
+	"github.com/coldze/primitives/custom_error"
+	"github.com/coldze/primitives/logs"
+)
+
+func formatAppliedAt(state *mongo.ChangeState) string {
+	if state.AppliedAt.IsZero() {
+		return "-"
+	}
+	return state.AppliedAt.Format(time.RFC3339)
+}
+
+type statusSummary struct {
+	counters map[mongo.ChangeStatus]int
+	modified int
+}
+
+// writeStatus prints table of changes' states and counts them.
+func writeStatus(out io.Writer, states []*mongo.ChangeState) *statusSummary {
+	summary := &statusSummary{
+		counters: map[mongo.ChangeStatus]int{},
+	}
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "CHANGE SET\tCHANGE\tSTATE\tAPPLIED AT (UTC)")
+	for _, state := range states {
+		summary.counters[state.Status]++
+		if state.Status == mongo.CHANGE_STATUS_REAPPLY && state.Modified {
+			summary.modified++
+		}
+		fmt.Fprintf(writer, "%v\t%v\t%v\t%v\n", state.ChangeSetID, state.ChangeID, state.Status, formatAppliedAt(state))
+	}
+	writer.Flush()
+	return summary
+}
+
+// check fails, if database is not up to date with changelog.
+func (s *statusSummary) check() custom_error.CustomError {
+	if s.counters[mongo.CHANGE_STATUS_CHECKSUM_MISMATCH] > 0 {
+		return custom_error.MakeErrorf("There are changes with checksum mismatch: %v", s.counters[mongo.CHANGE_STATUS_CHECKSUM_MISMATCH])
+	}
+	unfinished := s.counters[mongo.CHANGE_STATUS_IN_PROGRESS] + s.counters[mongo.CHANGE_STATUS_FAILED]
+	if unfinished > 0 {
+		return custom_error.MakeErrorf("There are unfinished changes: %v", unfinished)
+	}
+	// runAlways changes are always reapplied, so only changes, modified since they were applied, are pending.
+	pending := s.counters[mongo.CHANGE_STATUS_PENDING] + s.modified
+	if pending > 0 {
+		return custom_error.MakeErrorf("There are pending changes: %v", pending)
+	}
+	return nil
+}
+
+func Status(path string, failOnPending bool, opts *RunOptions, log logs.Logger) custom_error.CustomError {
+	properties, errValue := newProperties(opts)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to load properties.")
+	}
+	changeLog, errValue := engine.NewChangeLog(path, properties)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to load changelog.")
+	}
+	ctx := context.Background()
+
+	mongoClient, err := newMgoClient(ctx, changeLog.GetConnectionString())
+	if err != nil {
+		return custom_error.NewErrorf(err, "Failed to connect to mongo.")
+	}
+	defer mongoClient.Disconnect(ctx)
+	db := mongoClient.Database(changeLog.GetDBName())
+
+	states := []*mongo.ChangeState{}
+	collectState := func(state *mongo.ChangeState) custom_error.CustomError {
+		states = append(states, state)
+		return nil
+	}
+
+	collector, errValue := mongo.NewMongoChangeSetStateCollector(db, engine.COLLECTION_NAME_MIGRATIONS_LOG, collectState)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to create state collector.")
+	}
+	collector, errValue = engine.NewContextFilter(opts.Contexts, collector)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to create context filter.")
+	}
+
+	errValue = changeLog.Apply(collector)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to collect changes' state.")
+	}
+
+	summary := writeStatus(os.Stdout, states)
+	counters := summary.counters
+	log.Infof("Applied: %v. Pending: %v. Reapply: %v. Checksum mismatch: %v. In progress: %v. Failed: %v.", counters[mongo.CHANGE_STATUS_APPLIED], counters[mongo.CHANGE_STATUS_PENDING], counters[mongo.CHANGE_STATUS_REAPPLY], counters[mongo.CHANGE_STATUS_CHECKSUM_MISMATCH], counters[mongo.CHANGE_STATUS_IN_PROGRESS], counters[mongo.CHANGE_STATUS_FAILED])
+
+	if !failOnPending {
+		return nil
+	}
+	return summary.check()
+}
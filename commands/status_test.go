@@ -0,0 +1,55 @@
+package commands
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coldze/mongol/primitives/mongo"
+)
+
+func TestWriteStatus(t *testing.T) {
+	states := []*mongo.ChangeState{
+		{ChangeSetID: "20190101_00001", ChangeID: "20190101_00001_users", Status: mongo.CHANGE_STATUS_APPLIED, AppliedAt: time.Date(2019, 1, 1, 10, 0, 0, 0, time.UTC)},
+		{ChangeSetID: "20190101_00001", ChangeID: "20190101_00001_indexes", Status: mongo.CHANGE_STATUS_PENDING},
+	}
+	out := &bytes.Buffer{}
+	writeStatus(out, states)
+	expected := strings.Join([]string{
+		"CHANGE SET      CHANGE                  STATE    APPLIED AT (UTC)",
+		"20190101_00001  20190101_00001_users    applied  2019-01-01T10:00:00Z",
+		"20190101_00001  20190101_00001_indexes  pending  -",
+		"",
+	}, "\n")
+	if out.String() != expected {
+		t.Errorf("Unexpected output.\nExpected:\n%v\nGot:\n%v", expected, out.String())
+	}
+}
+
+func TestStatusCheck(t *testing.T) {
+	cases := []struct {
+		name     string
+		states   []*mongo.ChangeState
+		expected string
+	}{
+		{"up to date", []*mongo.ChangeState{{Status: mongo.CHANGE_STATUS_APPLIED}}, ""},
+		{"run always", []*mongo.ChangeState{{Status: mongo.CHANGE_STATUS_REAPPLY}}, ""},
+		{"pending", []*mongo.ChangeState{{Status: mongo.CHANGE_STATUS_APPLIED}, {Status: mongo.CHANGE_STATUS_PENDING}}, "There are pending changes: 1"},
+		{"modified", []*mongo.ChangeState{{Status: mongo.CHANGE_STATUS_REAPPLY, Modified: true}}, "There are pending changes: 1"},
+		{"unfinished", []*mongo.ChangeState{{Status: mongo.CHANGE_STATUS_IN_PROGRESS}, {Status: mongo.CHANGE_STATUS_FAILED}, {Status: mongo.CHANGE_STATUS_PENDING}}, "There are unfinished changes: 2"},
+		{"checksum mismatch", []*mongo.ChangeState{{Status: mongo.CHANGE_STATUS_CHECKSUM_MISMATCH}, {Status: mongo.CHANGE_STATUS_FAILED}}, "There are changes with checksum mismatch: 1"},
+	}
+	for _, c := range cases {
+		err := writeStatus(&bytes.Buffer{}, c.states).check()
+		if len(c.expected) <= 0 {
+			if err != nil {
+				t.Errorf("%v: unexpected error: %v", c.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), c.expected) {
+			t.Errorf("%v: expected error with '%v', got: %v", c.name, c.expected, err)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package commands
+
+import (
+	"context"
+
+	"github.com/coldze/mongol/engine"
+	"github.com/coldze/mongol/primitives/mongo"
+	"github.com/coldze/primitives/custom_error"
+	"github.com/coldze/primitives/logs"
+)
+
+func Tag(path string, tag string, opts *RunOptions, log logs.Logger) custom_error.CustomError {
+	properties, errValue := newProperties(opts)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to load properties.")
+	}
+	changeLog, errValue := engine.NewChangeLog(path, properties)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to load changelog.")
+	}
+	ctx := context.Background()
+
+	mongoClient, err := newMgoClient(ctx, changeLog.GetConnectionString())
+	if err != nil {
+		return custom_error.NewErrorf(err, "Failed to connect to mongo.")
+	}
+	defer mongoClient.Disconnect(ctx)
+	db := mongoClient.Database(changeLog.GetDBName())
+
+	lock, errValue := lockDatabase(ctx, db, opts, log)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to lock database.")
+	}
+	defer unlock(lock, log)
+
+	changeID, errValue := mongo.TagLastApplied(ctx, db, engine.COLLECTION_NAME_MIGRATIONS_LOG, tag)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to tag last applied change.")
+	}
+	log.Infof("Change '%v' tagged with '%v'", changeID, tag)
+	return nil
+}
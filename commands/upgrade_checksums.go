@@ -0,0 +1,55 @@
+package commands
+
+import (
+	"context"
+
+	"github.com/coldze/mongol/engine"
+	"github.com/coldze/mongol/primitives/mongo"
+	"github.com/coldze/primitives/custom_error"
+	"github.com/coldze/primitives/logs"
+)
+
+func UpgradeChecksums(path string, opts *RunOptions, log logs.Logger) custom_error.CustomError {
+	properties, errValue := newProperties(opts)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to load properties.")
+	}
+	changeLog, errValue := engine.NewChangeLog(path, properties)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to load changelog.")
+	}
+	ctx := context.Background()
+
+	mongoClient, err := newMgoClient(ctx, changeLog.GetConnectionString())
+	if err != nil {
+		return custom_error.NewErrorf(err, "Failed to connect to mongo.")
+	}
+	defer mongoClient.Disconnect(ctx)
+	db := mongoClient.Database(changeLog.GetDBName())
+
+	lock, errValue := lockDatabase(ctx, db, opts, log)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to lock database.")
+	}
+	defer unlock(lock, log)
+
+	upgraded := 0
+	for _, changeSet := range changeLog.GetChangeSets() {
+		for _, change := range changeSet.Changes {
+			if len(change.LegacyHash) <= 0 || change.LegacyHash == change.Hash {
+				continue
+			}
+			ok, errValue := mongo.UpgradeChecksum(ctx, db, engine.COLLECTION_NAME_MIGRATIONS_LOG, change.ID, change.LegacyHash, change.Hash)
+			if errValue != nil {
+				return custom_error.NewErrorf(errValue, "Failed to upgrade checksum of change '%v'.", change.ID)
+			}
+			if !ok {
+				continue
+			}
+			log.Infof("Change '%v' checksum upgraded: %v -> %v", change.ID, change.LegacyHash, change.Hash)
+			upgraded++
+		}
+	}
+	log.Infof("Upgraded checksums: %v", upgraded)
+	return nil
+}
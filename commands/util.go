@@ -2,12 +2,29 @@ package commands
 
 import (
 	"context"
+	"os"
+	"strings"
 
+	"github.com/coldze/mongol/engine"
+	"github.com/coldze/mongol/primitives"
+	"github.com/coldze/mongol/primitives/mongo"
 	"github.com/coldze/primitives/custom_error"
+	"github.com/coldze/primitives/logs"
 	mgo "go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+type noLock struct {
+}
+
+func (n *noLock) Unlock() error {
+	return nil
+}
+
+func (n *noLock) Lost() <-chan struct{} {
+	return nil
+}
+
 func newMgoClient(ctx context.Context, uri string) (*mgo.Client, custom_error.CustomError) {
 	clientOpts := options.Client()
 	if clientOpts == nil {
@@ -27,3 +44,108 @@ func newMgoClient(ctx context.Context, uri string) (*mgo.Client, custom_error.Cu
 	}
 	return mongoClient, nil
 }
+
+func lockDatabase(ctx context.Context, db *mgo.Database, opts *RunOptions, log logs.Logger) (primitives.SyncLock, custom_error.CustomError) {
+	if opts.DryRun {
+		log.Infof("Dry-run: database is not locked.")
+		return &noLock{}, nil
+	}
+	return mongo.Lock(ctx, db, opts.WaitForLock, log)
+}
+
+func unlock(lock primitives.SyncLock, log logs.Logger) {
+	err := lock.Unlock()
+	if err != nil {
+		log.Errorf("Failed to unlock database. Error: %v", err)
+	}
+}
+
+// checkUnfinished refuses to run, while migrations log has unfinished changes, including the ones outside of contexts filter
+// or already removed from changelog.
+func checkUnfinished(ctx context.Context, db *mgo.Database) custom_error.CustomError {
+	records, errValue := mongo.GetUnfinished(ctx, db, engine.COLLECTION_NAME_MIGRATIONS_LOG)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to get unfinished changes.")
+	}
+	if len(records) <= 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(records))
+	for _, record := range records {
+		ids = append(ids, record.ID)
+	}
+	return custom_error.MakeErrorf("There are unfinished changes: %v. Check database and resolve them with 'mongol repair'", strings.Join(ids, ", "))
+}
+
+func newDocumentApplier(ctx context.Context, db *mgo.Database, opts *RunOptions) (engine.DocumentApplier, func(), custom_error.CustomError) {
+	if !opts.DryRun {
+		return mongo.NewDbChanger(db, ctx), func() {}, nil
+	}
+	if len(opts.DryRunOutput) <= 0 {
+		return mongo.NewDocumentRecorder(os.Stdout), func() {}, nil
+	}
+	output, err := os.Create(opts.DryRunOutput)
+	if err != nil {
+		return nil, nil, custom_error.MakeErrorf("Failed to create dry-run output file '%v'. Error: %v", opts.DryRunOutput, err)
+	}
+	return mongo.NewDocumentRecorder(output), func() { output.Close() }, nil
+}
+
+func newSessionRunner(ctx context.Context, db *mgo.Database, opts *RunOptions, log logs.Logger) (engine.SessionRunner, custom_error.CustomError) {
+	if opts.DryRun {
+		log.Infof("Dry-run: transactions are simulated.")
+		return nil, nil
+	}
+	supported, errValue := mongo.SupportsTransactions(ctx, db)
+	if errValue != nil {
+		return nil, custom_error.NewErrorf(errValue, "Failed to check transactions support.")
+	}
+	if !supported {
+		log.Infof("Server doesn't support transactions. Transactions are simulated.")
+		return nil, nil
+	}
+	errValue = mongo.EnsureCollection(ctx, db, engine.COLLECTION_NAME_MIGRATIONS_LOG)
+	if errValue != nil {
+		return nil, custom_error.NewErrorf(errValue, "Failed to prepare migrations log for transactions.")
+	}
+	return mongo.NewMongoSessionRunner(ctx, db, log), nil
+}
+
+func excludeChanges(appliedList map[string]struct{}, notAppliedList map[string]struct{}, toRollback map[string]struct{}) map[string]struct{} {
+	if toRollback == nil {
+		return notAppliedList
+	}
+	skipList := map[string]struct{}{}
+	for changeID := range notAppliedList {
+		skipList[changeID] = struct{}{}
+	}
+	for changeID := range appliedList {
+		_, ok := toRollback[changeID]
+		if ok {
+			continue
+		}
+		skipList[changeID] = struct{}{}
+	}
+	return skipList
+}
+
+func newProperties(opts *RunOptions) (engine.Properties, custom_error.CustomError) {
+	properties := engine.Properties{}
+	if len(opts.PropertiesFile) > 0 {
+		fileProperties, errValue := engine.LoadProperties(opts.PropertiesFile)
+		if errValue != nil {
+			return nil, custom_error.NewErrorf(errValue, "Failed to load properties file.")
+		}
+		for k, v := range fileProperties {
+			properties[k] = v
+		}
+	}
+	for _, property := range opts.Properties {
+		key, value, errValue := engine.ParseProperty(property)
+		if errValue != nil {
+			return nil, custom_error.NewErrorf(errValue, "Failed to parse property.")
+		}
+		properties[key] = value
+	}
+	return properties, nil
+}
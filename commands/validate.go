@@ -0,0 +1,36 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/coldze/mongol/engine"
+	"github.com/coldze/primitives/custom_error"
+	"github.com/coldze/primitives/logs"
+)
+
+func Validate(path string, strict bool, opts *RunOptions, log logs.Logger) custom_error.CustomError {
+	properties, errValue := newProperties(opts)
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to load properties.")
+	}
+	issues := engine.ValidateChangeLog(path, properties)
+	errors := 0
+	warnings := 0
+	for _, issue := range issues {
+		fmt.Fprintln(os.Stdout, issue)
+		if issue.Warning {
+			warnings++
+			continue
+		}
+		errors++
+	}
+	log.Infof("Errors: %v. Warnings: %v.", errors, warnings)
+	if errors > 0 {
+		return custom_error.MakeErrorf("Changelog is invalid. Errors: %v", errors)
+	}
+	if strict && warnings > 0 {
+		return custom_error.MakeErrorf("Changelog has warnings: %v", warnings)
+	}
+	return nil
+}
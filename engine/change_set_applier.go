@@ -2,6 +2,7 @@ package engine
 
 import (
 	"github.com/coldze/primitives/custom_error"
+	"github.com/coldze/primitives/logs"
 )
 
 type changeSetApplierStrategy func(changes []*Change, transaction Transaction) custom_error.CustomError
@@ -9,6 +10,9 @@ type changeSetApplierStrategy func(changes []*Change, transaction Transaction) c
 type changeSetApplier struct {
 	startTransaction TransactionFactory
 	strategy         changeSetApplierStrategy
+	checker          PreconditionChecker
+	appliedChanges   map[string]struct{}
+	log              logs.Logger
 }
 
 func extractError(r interface{}, changeID string) custom_error.CustomError {
@@ -43,11 +47,76 @@ func backwardChangeSetApplierStrategy(changes []*Change, transaction Transaction
 	return nil
 }
 
+func (c *changeSetApplier) hasPendingChanges(changeSet *ChangeSet) bool {
+	for _, change := range changeSet.Changes {
+		_, applied := c.appliedChanges[change.ID]
+		if !applied {
+			return true
+		}
+	}
+	return false
+}
+
+// markRan replaces migrations of selected changes, so they are recorded in migrations log as MARK_RAN without running.
+func markRan(changeSet *ChangeSet, selected func(change *Change) bool) *ChangeSet {
+	changes := make([]*Change, 0, len(changeSet.Changes))
+	for _, change := range changeSet.Changes {
+		if !selected(change) {
+			changes = append(changes, change)
+			continue
+		}
+		marked := *change
+		marked.Forward = &DummyMigration{}
+		marked.Backward = &DummyMigration{}
+		marked.MarkRan = true
+		changes = append(changes, &marked)
+	}
+	marked := *changeSet
+	marked.Changes = changes
+	return &marked
+}
+
+func markAll(change *Change) bool {
+	return true
+}
+
+func (c *changeSetApplier) checkPreconditions(changeSet *ChangeSet) (*ChangeSet, custom_error.CustomError) {
+	if c.checker == nil || changeSet.Preconditions == nil || !c.hasPendingChanges(changeSet) {
+		return changeSet, nil
+	}
+	failed, err := changeSet.Preconditions.Evaluate(c.checker)
+	if err != nil {
+		return nil, custom_error.NewErrorf(err, "Failed to evaluate preconditions of changeset '%v'.", changeSet.ID)
+	}
+	if len(failed) <= 0 {
+		return changeSet, nil
+	}
+	switch changeSet.Preconditions.OnFail {
+	case PRECONDITION_ON_FAIL_CONTINUE:
+		c.log.Infof("Precondition '%v' failed. Skipping changeset '%v'.", failed, changeSet.ID)
+		return nil, nil
+	case PRECONDITION_ON_FAIL_MARK_RAN:
+		c.log.Infof("Precondition '%v' failed. Marking changeset '%v' as applied without running it.", failed, changeSet.ID)
+		return markRan(changeSet, markAll), nil
+	case PRECONDITION_ON_FAIL_WARN:
+		c.log.Infof("Warning. Precondition '%v' failed. Applying changeset '%v' anyway.", failed, changeSet.ID)
+		return changeSet, nil
+	}
+	return nil, custom_error.MakeErrorf("Precondition '%v' failed for changeset '%v'.", failed, changeSet.ID)
+}
+
 func (c *changeSetApplier) Process(changeSet *ChangeSet) (result custom_error.CustomError) {
 	if changeSet == nil {
 		return custom_error.MakeErrorf("Failed to apply changeset. Nil pointer provided.")
 	}
-	transaction, err := c.startTransaction(changeSet.ID)
+	changeSet, err := c.checkPreconditions(changeSet)
+	if err != nil {
+		return custom_error.NewErrorf(err, "Preconditions check failed")
+	}
+	if changeSet == nil {
+		return nil
+	}
+	transaction, err := c.startTransaction(changeSet)
 	if err != nil {
 		return custom_error.NewErrorf(err, "Failed to start transaction")
 	}
@@ -57,10 +126,11 @@ func (c *changeSetApplier) Process(changeSet *ChangeSet) (result custom_error.Cu
 			if commitErr == nil {
 				return
 			}
+			result = custom_error.NewErrorf(commitErr, "Failed to commit changeset with ID '%v'.", changeSet.ID)
 		}
 		rollbackErr := transaction.Rollback()
 		if rollbackErr != nil {
-			result = custom_error.NewErrorf(rollbackErr, "Failed to rollback changeset with ID '%v' after error during application. Application error: %v", result)
+			result = custom_error.NewErrorf(rollbackErr, "Failed to rollback changeset with ID '%v' after error during application. Application error: %v", changeSet.ID, result)
 		}
 	}()
 
@@ -92,13 +162,38 @@ func (c *changeSetApplier) Process(changeSet *ChangeSet) (result custom_error.Cu
 
 }
 
-func NewChangeSetApplier(startTransaction TransactionFactory) (ChangeSetProcessor, custom_error.CustomError) {
+// NewChangeSetApplier evaluates change sets' preconditions with checker, unless it's nil.
+func NewChangeSetApplier(startTransaction TransactionFactory, checker PreconditionChecker, appliedChanges map[string]struct{}, log logs.Logger) (ChangeSetProcessor, custom_error.CustomError) {
 	return &changeSetApplier{
 		startTransaction: startTransaction,
 		strategy:         forwardChangeSetApplierStrategy,
+		checker:          checker,
+		appliedChanges:   appliedChanges,
+		log:              log,
 	}, nil
 }
 
+type markedRanFilter struct {
+	markedRan map[string]struct{}
+	processor ChangeSetProcessor
+}
+
+func (m *markedRanFilter) Process(changeSet *ChangeSet) custom_error.CustomError {
+	return m.processor.Process(markRan(changeSet, func(change *Change) bool {
+		_, ok := m.markedRan[change.ID]
+		return ok
+	}))
+}
+
+// NewMarkedRanFilter stops rollback from running migrations of changes, that were recorded as MARK_RAN and never ran,
+// so only their records are removed.
+func NewMarkedRanFilter(markedRan map[string]struct{}, processor ChangeSetProcessor) ChangeSetProcessor {
+	return &markedRanFilter{
+		markedRan: markedRan,
+		processor: processor,
+	}
+}
+
 func NewRollbackChangeSetApplier(startTransaction TransactionFactory) (ChangeSetProcessor, custom_error.CustomError) {
 	return &changeSetApplier{
 		startTransaction: startTransaction,
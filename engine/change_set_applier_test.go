@@ -0,0 +1,59 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coldze/primitives/custom_error"
+	"github.com/coldze/primitives/logs"
+)
+
+type changeSetRecorder struct {
+	applier DocumentApplier
+}
+
+func (r *changeSetRecorder) Process(changeSet *ChangeSet) custom_error.CustomError {
+	for i := len(changeSet.Changes) - 1; i >= 0; i-- {
+		err := changeSet.Changes[i].Backward.Apply(r.applier)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestMarkedRanFilterSkipsRollbackMigrations(t *testing.T) {
+	applier := &recordingApplier{}
+	filter := NewMarkedRanFilter(map[string]struct{}{"first": {}}, &changeSetRecorder{applier: applier})
+	changeSet := &ChangeSet{ID: "set", Changes: []*Change{newTestChange("first", "first"), newTestChange("second", "second")}}
+	err := filter.Process(changeSet)
+	if err != nil {
+		t.Fatalf("Failed to process change set: %v", err)
+	}
+	expected := []string{"drop second"}
+	if !reflect.DeepEqual(applier.applied, expected) {
+		t.Errorf("Expected %v, got %v", expected, applier.applied)
+	}
+}
+
+func TestMarkRanIsRecorded(t *testing.T) {
+	applier := &recordingApplier{}
+	factory, err := NewSimulatedTransactionFactory(applier, NewTransactionRecordFactory(testLogCollection, ""), NewRollbackTransactionRecordFactory(testLogCollection),
+		NewJournalRecordFactory(testLogCollection, JOURNAL_OPERATION_MIGRATE), map[string]struct{}{}, -1, logs.NewStdLogger())
+	if err != nil {
+		t.Fatalf("Failed to create factory: %v", err)
+	}
+	changeSet := markRan(&ChangeSet{ID: "set", Changes: []*Change{newTestChange("first", "first")}}, markAll)
+	transaction, err := factory(changeSet)
+	if err != nil {
+		t.Fatalf("Failed to start transaction: %v", err)
+	}
+	err = transaction.Apply(changeSet.Changes[0])
+	if err != nil {
+		t.Fatalf("Failed to apply change: %v", err)
+	}
+	expected := []string{"update first IN_PROGRESS", "update first MARK_RAN"}
+	if !reflect.DeepEqual(applier.applied, expected) {
+		t.Errorf("Expected %v, got %v", expected, applier.applied)
+	}
+}
@@ -1,11 +1,8 @@
 package engine
 
 import (
-	"crypto/md5"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"hash"
 	"io/ioutil"
 	"path/filepath"
 
@@ -21,9 +18,14 @@ type ChangeSetSource interface {
 	Apply(processor ChangeSetProcessor) custom_error.CustomError
 }
 
-type ChangeLog interface {
+// ConnectionSettings is a part of main changelog, that is needed to connect to database.
+type ConnectionSettings interface {
 	GetConnectionString() string
 	GetDBName() string
+}
+
+type ChangeLog interface {
+	ConnectionSettings
 	GetChangeSets() []*ChangeSet
 	GetChangeSetSource() ChangeSetSource
 	Apply(processor ChangeSetProcessor) custom_error.CustomError
@@ -32,9 +34,22 @@ type ChangeLog interface {
 type MigrationFile struct {
 	Path         string `json:"include,omitempty"`
 	RelativePath bool   `json:"relativeToChangelogFile"`
+	IncludeAll   string `json:"includeAll,omitempty"`
+	Recursive    bool   `json:"recursive,omitempty"`
+	Pattern      string `json:"pattern,omitempty"`
 }
 
 func (m *MigrationFile) validate() custom_error.CustomError {
+	if len(m.IncludeAll) > 0 {
+		if len(m.Path) > 0 {
+			return custom_error.MakeErrorf("MigrationFile format error: both 'include' and 'includeAll' specified")
+		}
+		_, err := matchIncludeAll(m, "")
+		if err != nil {
+			return custom_error.NewErrorf(err, "MigrationFile format error: invalid 'pattern'")
+		}
+		return nil
+	}
 	if len(m.Path) <= 0 {
 		return custom_error.MakeErrorf("MigrationFile format error: path is empty. Expected non-empty field 'path'")
 	}
@@ -48,10 +63,10 @@ func getFullPath(relativePath bool, workingDir string, changelogPath string, fil
 	return filepath.Join(workingDir, filePath)
 }
 
-func NewMultiMigration(m []*MigrationFile, workingDir string, changelogPath string, hash hash.Hash) (Migration, custom_error.CustomError) {
+func NewMultiMigration(m []*MigrationFile, workingDir string, changelogPath string, checksum *ChangeChecksum, properties Properties) (Migration, custom_error.CustomError) {
 	migrations := make([]Migration, 0, len(m))
 	for i := range m {
-		migration, err := NewMigration(m[i], workingDir, changelogPath, hash)
+		migration, err := NewMigration(m[i], workingDir, changelogPath, checksum, properties)
 		if err != nil {
 			return nil, custom_error.NewErrorf(err, "Failed to generate multi-migration")
 		}
@@ -62,7 +77,7 @@ func NewMultiMigration(m []*MigrationFile, workingDir string, changelogPath stri
 	}, nil
 }
 
-func NewMigration(m *MigrationFile, workingDir string, changelogPath string, hash hash.Hash) (Migration, custom_error.CustomError) {
+func NewMigration(m *MigrationFile, workingDir string, changelogPath string, checksum *ChangeChecksum, properties Properties) (Migration, custom_error.CustomError) {
 	if m == nil {
 		return &DummyMigration{}, nil
 	}
@@ -75,12 +90,30 @@ func NewMigration(m *MigrationFile, workingDir string, changelogPath string, has
 	if ioErr != nil {
 		return nil, custom_error.MakeErrorf("Failed to read file '%v'. Error: %v", m.Path, ioErr)
 	}
-	migrationContent, err := decoding.DecodeMigration(migrationRawContent)
-
+	if IsJavaScript(fullPath) {
+		checksum.textWriter().Write(migrationRawContent)
+		return NewJSMigration(m, fullPath, migrationRawContent)
+	}
+	migrationContentWithProperties, source, err := properties.Substitute(fullPath, migrationRawContent)
+	if err != nil {
+		return nil, custom_error.NewErrorf(err, "Failed to generate migration from file '%v'", m.Path)
+	}
+	migrationJSONContent, err := decoding.ToJSON(fullPath, migrationContentWithProperties)
+	if err != nil {
+		return nil, custom_error.NewErrorf(err, "Failed to generate migration from file '%v'", m.Path)
+	}
+	migrationContent, err := decoding.DecodeMigration(fullPath, migrationJSONContent, source)
+	if err != nil {
+		return nil, custom_error.NewErrorf(err, "Failed to generate migration from file '%v'", m.Path)
+	}
+	err = checksum.writeMigration(fullPath, migrationRawContent)
+	if err != nil {
+		return nil, custom_error.NewErrorf(err, "Failed to calculate checksum of migration from file '%v'", m.Path)
+	}
+	migrationContent, err = resolveLoadData(migrationContent, filepath.Dir(fullPath), checksum)
 	if err != nil {
-		return nil, custom_error.MakeErrorf("Failed to generate migration from file '%v'. Error: %v", m.Path, err)
+		return nil, custom_error.NewErrorf(err, "Failed to generate migration from file '%v'", m.Path)
 	}
-	hash.Write(migrationRawContent)
 	return &SimpleMigration{
 		source:   m,
 		commands: migrationContent,
@@ -109,6 +142,14 @@ type SimpleMigration struct {
 
 func (s *SimpleMigration) Apply(visitor DocumentApplier) custom_error.CustomError {
 	for i := range s.commands {
+		nested, ok := s.commands[i].(Migration)
+		if ok {
+			err := nested.Apply(visitor)
+			if err != nil {
+				return err
+			}
+			continue
+		}
 		err := visitor.Apply(s.commands[i])
 		if err != nil {
 			return custom_error.NewErrorf(err, "Failed to apply command: %v", s.commands[i])
@@ -117,6 +158,95 @@ func (s *SimpleMigration) Apply(visitor DocumentApplier) custom_error.CustomErro
 	return nil
 }
 
+type commandCollector struct {
+	commands []interface{}
+}
+
+func (c *commandCollector) Apply(value interface{}) custom_error.CustomError {
+	c.commands = append(c.commands, value)
+	return nil
+}
+
+// invertibleMigration is implemented by migrations, that are inverted as a whole, instead of command by command.
+type invertibleMigration interface {
+	invert() (Migration, custom_error.CustomError)
+}
+
+// invertCommands inverts plain commands with decoding.InvertCommands and nested migrations with their own rollbacks.
+func invertCommands(commands []interface{}) ([]interface{}, custom_error.CustomError) {
+	res := []interface{}{}
+	end := len(commands)
+	for i := len(commands) - 1; i >= -1; i-- {
+		var nested Migration
+		if i >= 0 {
+			var ok bool
+			nested, ok = commands[i].(Migration)
+			if !ok {
+				continue
+			}
+		}
+		inverted, err := decoding.InvertCommands(commands[i+1 : end])
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, inverted...)
+		end = i
+		if nested == nil {
+			break
+		}
+		rollback, err := newGeneratedRollback(nested)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, rollback)
+	}
+	return res, nil
+}
+
+func newGeneratedRollback(forward Migration) (Migration, custom_error.CustomError) {
+	switch typed := forward.(type) {
+	case *DummyMigration:
+		return typed, nil
+	case *MultipleMigration:
+		migrations := make([]Migration, 0, len(typed.migrations))
+		for i := len(typed.migrations) - 1; i >= 0; i-- {
+			rollback, err := newGeneratedRollback(typed.migrations[i])
+			if err != nil {
+				return nil, err
+			}
+			migrations = append(migrations, rollback)
+		}
+		return &MultipleMigration{
+			migrations: migrations,
+		}, nil
+	case *SimpleMigration:
+		commands, err := invertCommands(typed.commands)
+		if err != nil {
+			return nil, err
+		}
+		return &SimpleMigration{
+			commands: commands,
+		}, nil
+	case *JSMigration:
+		// script's commands can differ between runs, so rollback, generated from them, wouldn't match applied change
+		return nil, custom_error.MakeErrorf("JavaScript migration '%v' can't be inverted automatically", typed.source.Path)
+	case invertibleMigration:
+		return typed.invert()
+	}
+	collector := &commandCollector{}
+	err := forward.Apply(collector)
+	if err != nil {
+		return nil, custom_error.NewErrorf(err, "Failed to collect forward commands")
+	}
+	commands, err := decoding.InvertCommands(collector.commands)
+	if err != nil {
+		return nil, err
+	}
+	return &SimpleMigration{
+		commands: commands,
+	}, nil
+}
+
 type MultipleMigration struct {
 	migrations []Migration
 }
@@ -132,16 +262,32 @@ func (s *MultipleMigration) Apply(visitor DocumentApplier) custom_error.CustomEr
 }
 
 type ChangeFile struct {
-	Forward  []*MigrationFile `json:"migration"`
-	Backward []*MigrationFile `json:"rollback,omitempty"`
+	ID          string           `json:"id,omitempty"`
+	Author      string           `json:"author,omitempty"`
+	RunAlways   bool             `json:"runAlways,omitempty"`
+	RunOnChange bool             `json:"runOnChange,omitempty"`
+	Go          string           `json:"go,omitempty"`
+	Forward     []*MigrationFile `json:"migration"`
+	Backward    []*MigrationFile `json:"rollback,omitempty"`
+	// GenerateRollback is set, when rollback is omitted, so it's derived from forward migration.
+	GenerateRollback bool `json:"-"`
 }
 
 type changeFileInternal struct {
-	Forward  interface{} `json:"migration,omitempty"`
-	Backward interface{} `json:"rollback,omitempty"`
+	ID          string      `json:"id,omitempty"`
+	Author      string      `json:"author,omitempty"`
+	RunAlways   bool        `json:"runAlways,omitempty"`
+	RunOnChange bool        `json:"runOnChange,omitempty"`
+	Go          string      `json:"go,omitempty"`
+	Forward     interface{} `json:"migration,omitempty"`
+	Backward    interface{} `json:"rollback,omitempty"`
 }
 
 func collectMigrationFilesFromMap(mapVal map[string]interface{}) ([]*MigrationFile, custom_error.CustomError) {
+	_, ok := mapVal["includeAll"]
+	if ok {
+		return collectIncludeAllFromMap(mapVal)
+	}
 	if len(mapVal) > 2 {
 		return nil, custom_error.MakeErrorf("Extra fields specified. %+v", mapVal)
 	}
@@ -167,14 +313,18 @@ func collectMigrationFilesFromMap(mapVal map[string]interface{}) ([]*MigrationFi
 			},
 		}, nil
 	}
-	pathArr, ok := paths.([]string)
+	pathArr, ok := paths.([]interface{})
 	if !ok {
 		return nil, custom_error.MakeErrorf("Unexpected type for `include` entry. Type: %T", paths)
 	}
 	migrations := make([]*MigrationFile, 0, len(pathArr))
 	for i := range pathArr {
+		strPath, ok := pathArr[i].(string)
+		if !ok {
+			return nil, custom_error.MakeErrorf("Unexpected type for `include` entry #%v. Type: %T", i, pathArr[i])
+		}
 		migrations = append(migrations, &MigrationFile{
-			Path:         pathArr[i],
+			Path:         strPath,
 			RelativePath: relative,
 		})
 	}
@@ -256,11 +406,21 @@ func (c *ChangeFile) UnmarshalJSON(data []byte) error {
 	if cErr != nil {
 		return custom_error.NewErrorf(cErr, "Failed to process migration's description (forward)")
 	}
-	if forward == nil || len(forward) <= 0 {
+	if len(changeInternal.Go) > 0 {
+		if len(forward) > 0 || len(backward) > 0 {
+			return custom_error.MakeErrorf("Change '%v' is implemented in code, 'migration' and 'rollback' are not allowed", changeInternal.Go)
+		}
+	} else if forward == nil || len(forward) <= 0 {
 		return custom_error.MakeErrorf("Empty forward migration")
 	}
+	c.ID = changeInternal.ID
+	c.Go = changeInternal.Go
+	c.Author = changeInternal.Author
+	c.RunAlways = changeInternal.RunAlways
+	c.RunOnChange = changeInternal.RunOnChange
 	c.Forward = forward
 	c.Backward = backward
+	c.GenerateRollback = changeInternal.Backward == nil && len(changeInternal.Go) <= 0
 	return c.validate()
 	/*isSingleForward := changeInternal.Forward != nil
 	isMultipleForward := changeInternal.ForwardArr != nil
@@ -299,6 +459,9 @@ func validate(migrations []*MigrationFile) custom_error.CustomError {
 		if err != nil {
 			return custom_error.NewErrorf(err, "Migration is invalid")
 		}
+		if len(v.IncludeAll) > 0 {
+			return custom_error.MakeErrorf("Migration is invalid: 'includeAll' is supported only in main changelog")
+		}
 	}
 	return nil
 }
@@ -315,44 +478,96 @@ func (c *ChangeFile) validate() custom_error.CustomError {
 	return nil
 }
 
-func NewChange(c *ChangeFile, workingDir string, changelogPath string, id string) (*Change, custom_error.CustomError) {
-	changeHash := md5.New()
-	forward, err := NewMultiMigration(c.Forward, workingDir, changelogPath, changeHash)
+func newRegisteredChange(c *ChangeFile, id string) (*Change, custom_error.CustomError) {
+	registered, err := getRegisteredChange(c.Go)
+	if err != nil {
+		return nil, custom_error.NewErrorf(err, "Failed to generate change '%v'", id)
+	}
+	return &Change{
+		Backward:    registered.backward,
+		Forward:     registered.forward,
+		Hash:        registered.version,
+		ID:          id,
+		LegacyID:    id,
+		Author:      c.Author,
+		RunAlways:   c.RunAlways,
+		RunOnChange: c.RunOnChange,
+	}, nil
+}
+
+func NewChange(c *ChangeFile, workingDir string, changelogPath string, id string, properties Properties) (*Change, custom_error.CustomError) {
+	if len(c.Go) > 0 {
+		return newRegisteredChange(c, id)
+	}
+	checksum := NewChangeChecksum()
+	forward, err := NewMultiMigration(c.Forward, workingDir, changelogPath, checksum, properties)
 	if err != nil {
 		return nil, custom_error.NewErrorf(err, "Failed to generate change. Forward migration generate process failed.")
 	}
-	backward, err := NewMultiMigration(c.Backward, workingDir, changelogPath, changeHash)
+	backward, err := NewMultiMigration(c.Backward, workingDir, changelogPath, checksum, properties)
 	if err != nil {
 		return nil, custom_error.NewErrorf(err, "Failed to generate change. Backward migration generate process failed.")
 	}
-	hashValue := hex.EncodeToString(changeHash.Sum(nil))
+	if c.GenerateRollback {
+		backward, err = newGeneratedRollback(forward)
+		if err != nil {
+			return nil, custom_error.NewErrorf(err, "Failed to generate rollback for change '%v'. Specify 'rollback' explicitly, use empty list for no rollback.", id)
+		}
+	}
 	return &Change{
-		Backward: backward,
-		Forward:  forward,
-		Hash:     hashValue,
-		ID:       id,
+		Backward:    backward,
+		Forward:     forward,
+		Hash:        checksum.Value(),
+		LegacyHash:  checksum.Legacy(),
+		ID:          id,
+		LegacyID:    id,
+		Author:      c.Author,
+		RunAlways:   c.RunAlways,
+		RunOnChange: c.RunOnChange,
 	}, nil
 }
 
 type ChangeSetFile struct {
-	ID      string       `json:"id"`
-	Changes []ChangeFile `json:"changes,omitempty"`
+	ID            string         `json:"id"`
+	Transactional *bool          `json:"transactional,omitempty"`
+	Context       string         `json:"context,omitempty"`
+	Labels        string         `json:"labels,omitempty"`
+	Preconditions *Preconditions `json:"preconditions,omitempty"`
+	Changes       []ChangeFile   `json:"changes,omitempty"`
 }
 type Change struct {
-	Forward  Migration
-	Backward Migration
-	Hash     string
-	ID       string
+	Forward     Migration
+	Backward    Migration
+	Hash        string
+	LegacyHash  string
+	ID          string
+	LegacyID    string
+	Author      string
+	RunAlways   bool
+	RunOnChange bool
+	// MarkRan is set for changes, recorded without running, because preconditions failed with MARK_RAN.
+	MarkRan bool
+}
+
+// HasChecksum reports, that recorded checksum matches change. Records, written before checksums were versioned, contain MD5 of files.
+func (c *Change) HasChecksum(recorded string) bool {
+	return recorded == c.Hash || (len(c.LegacyHash) > 0 && recorded == c.LegacyHash)
 }
 
 type ChangeSet struct {
-	ID      string
-	Changes []*Change
+	ID            string
+	Transactional *bool
+	Contexts      []string
+	Labels        []string
+	Preconditions *Preconditions
+	Changes       []*Change
 }
 
 type ChangeSetApplyStrategy func(sets []*ChangeSet, processor ChangeSetProcessor) custom_error.CustomError
 
 type mainChangeLog struct {
+	path           string                 `json:"-"`
+	properties     Properties             `json:"-"`
 	workingDir     string                 `json:"-"`
 	Connection     string                 `json:"connection,omitempty"`
 	DbName         string                 `json:"dbname,omitempty"`
@@ -367,28 +582,103 @@ type mainChangeLogInternal struct {
 	MigrationFiles interface{} `json:"migrations,omitempty"`
 }
 
-func loadChangeSet(path string, workingDir string) (*ChangeSet, custom_error.CustomError) {
+func readChangeSetFile(path string, properties Properties) (*ChangeSetFile, custom_error.CustomError) {
 	changeSetData, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, custom_error.MakeErrorf("Failed to load changeset from '%v'. Error: %v", path, err)
 	}
+	changeSetData, source, errValue := properties.Substitute(path, changeSetData)
+	if errValue != nil {
+		return nil, custom_error.NewErrorf(errValue, "Failed to load changeset from '%v'", path)
+	}
+	changeSetData, errValue = decoding.ToJSON(path, changeSetData)
+	if errValue != nil {
+		return nil, custom_error.NewErrorf(errValue, "Failed to load changeset from '%v'", path)
+	}
 	changeSetFile := ChangeSetFile{}
 	err = json.Unmarshal(changeSetData, &changeSetFile)
 	if err != nil {
-		return nil, custom_error.MakeErrorf("Failed to unmarshal changeset. Error: %v", err)
+		return nil, custom_error.NewErrorf(decoding.NewJSONError(path, changeSetData, source, err), "Failed to unmarshal changeset")
 	}
+	if changeSetFile.Preconditions != nil {
+		errValue = changeSetFile.Preconditions.validate()
+		if errValue != nil {
+			return nil, custom_error.NewErrorf(errValue, "Invalid preconditions in changeset at path '%v'", path)
+		}
+	}
+	return &changeSetFile, nil
+}
+
+func getChangeID(changeSetFile *ChangeSetFile, index int) (string, string) {
+	legacyID := fmt.Sprintf("%v_transaction_entry_%v", changeSetFile.ID, index)
+	if len(changeSetFile.Changes[index].ID) > 0 {
+		return changeSetFile.ID + "_" + changeSetFile.Changes[index].ID, legacyID
+	}
+	return legacyID, legacyID
+}
+
+// changeLogVisitor receives problems and changes found while changelog is loaded. NewChangeLog stops at the first
+// problem, ValidateChangeLog reports all of them.
+type changeLogVisitor interface {
+	// onError returns error to stop loading or nil to continue with the next change.
+	onError(path string, err custom_error.CustomError) custom_error.CustomError
+	onChange(path string, changeFile *ChangeFile, change *Change)
+}
+
+type strictVisitor struct{}
+
+func (v *strictVisitor) onError(path string, err custom_error.CustomError) custom_error.CustomError {
+	return err
+}
+
+func (v *strictVisitor) onChange(path string, changeFile *ChangeFile, change *Change) {
+}
+
+func loadChangeSet(path string, workingDir string, properties Properties, visitor changeLogVisitor) (*ChangeSet, custom_error.CustomError) {
+	changeSetFile, errValue := readChangeSetFile(path, properties)
+	if errValue != nil {
+		return nil, visitor.onError(path, errValue)
+	}
+	if len(changeSetFile.ID) <= 0 {
+		errValue = visitor.onError(path, custom_error.MakeErrorf("No id provided for changeset at path '%v'. Expected non-empty field 'id'", path))
+		if errValue != nil {
+			return nil, errValue
+		}
+	}
+	contexts := splitContextNames(changeSetFile.Context)
+	labels := splitContextNames(changeSetFile.Labels)
 	changes := make([]*Change, 0, len(changeSetFile.Changes))
-	changeIDFormat := changeSetFile.ID + "_transaction_entry_%v"
+	changeIDs := map[string]struct{}{}
 	for i := range changeSetFile.Changes {
-		change, errValue := NewChange(&changeSetFile.Changes[i], workingDir, filepath.Dir(path), fmt.Sprintf(changeIDFormat, i))
+		changeID, legacyID := getChangeID(changeSetFile, i)
+		_, ok := changeIDs[changeID]
+		if ok {
+			errValue = visitor.onError(path, custom_error.MakeErrorf("Dublicated change id '%v' in changeset at path '%v'", changeID, path))
+			if errValue != nil {
+				return nil, errValue
+			}
+			continue
+		}
+		changeIDs[changeID] = struct{}{}
+		change, errValue := NewChange(&changeSetFile.Changes[i], workingDir, filepath.Dir(path), changeID, properties)
 		if errValue != nil {
-			return nil, custom_error.NewErrorf(errValue, "Failed to validate changeset at path '%v'", path)
+			errValue = visitor.onError(path, custom_error.NewErrorf(errValue, "Failed to validate changeset at path '%v'", path))
+			if errValue != nil {
+				return nil, errValue
+			}
+			continue
 		}
+		change.LegacyID = legacyID
+		visitor.onChange(path, &changeSetFile.Changes[i], change)
 		changes = append(changes, change)
 	}
 	return &ChangeSet{
-		ID:      changeSetFile.ID,
-		Changes: changes,
+		ID:            changeSetFile.ID,
+		Transactional: changeSetFile.Transactional,
+		Contexts:      contexts,
+		Labels:        labels,
+		Preconditions: changeSetFile.Preconditions,
+		Changes:       changes,
 	}, nil
 }
 
@@ -408,36 +698,93 @@ func (c *mainChangeLog) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
-func (c *mainChangeLog) validate() custom_error.CustomError {
+func (c *mainChangeLog) validate(visitor changeLogVisitor) custom_error.CustomError {
 	if len(c.Connection) <= 0 {
-		return custom_error.MakeErrorf("MainChangeLog format error: no connection string provided. Expected non-empty field 'connection'")
+		err := visitor.onError(c.path, custom_error.MakeErrorf("MainChangeLog format error: no connection string provided. Expected non-empty field 'connection'"))
+		if err != nil {
+			return err
+		}
 	}
 	if len(c.DbName) <= 0 {
-		return custom_error.MakeErrorf("MainChangeLog format error: no db-name provided. Expected non-empty field 'dbname'")
+		err := visitor.onError(c.path, custom_error.MakeErrorf("MainChangeLog format error: no db-name provided. Expected non-empty field 'dbname'"))
+		if err != nil {
+			return err
+		}
 	}
 	if (c.MigrationFiles == nil) || len(c.MigrationFiles) <= 0 {
-		return custom_error.MakeErrorf("MainChangeLog format error: no migrations specified. Expected non-empty field 'migrations'")
+		return visitor.onError(c.path, custom_error.MakeErrorf("MainChangeLog format error: no migrations specified. Expected non-empty field 'migrations'"))
 	}
 	changeSets := make([]*ChangeSet, 0, len(c.MigrationFiles))
+	changeSetPaths := map[string]string{}
 	for i := range c.MigrationFiles {
 		if c.MigrationFiles[i] == nil {
-			return custom_error.MakeErrorf("Nil migration. Index: %v (zero-based)", i)
+			err := visitor.onError(c.path, custom_error.MakeErrorf("Nil migration. Index: %v (zero-based)", i))
+			if err != nil {
+				return err
+			}
+			continue
 		}
 		err := c.MigrationFiles[i].validate()
 		if err != nil {
-			return custom_error.NewErrorf(err, "MainChangeLog format error: migrationFile #%v", i+1)
+			err = visitor.onError(c.path, custom_error.NewErrorf(err, "MainChangeLog format error: migrationFile #%v", i+1))
+			if err != nil {
+				return err
+			}
+			continue
 		}
-		fullPath := getFullPath(c.MigrationFiles[i].RelativePath, c.workingDir, c.workingDir, c.MigrationFiles[i].Path)
-		changeSet, err := loadChangeSet(fullPath, c.workingDir)
+		paths, err := c.getChangeSetPaths(c.MigrationFiles[i])
 		if err != nil {
-			return custom_error.NewErrorf(err, "Failed to load migration '%v'", c.MigrationFiles[i].Path)
+			err = visitor.onError(c.path, err)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		for _, fullPath := range paths {
+			changeSet, err := loadChangeSet(fullPath, c.workingDir, c.properties, visitor)
+			if err != nil {
+				return custom_error.NewErrorf(err, "Failed to load migration '%v'", fullPath)
+			}
+			if changeSet == nil {
+				continue
+			}
+			previous, ok := changeSetPaths[changeSet.ID]
+			if ok {
+				err = visitor.onError(fullPath, custom_error.MakeErrorf("Dublicated changeset id '%v' at path '%v', already defined at path '%v'", changeSet.ID, fullPath, previous))
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			changeSetPaths[changeSet.ID] = fullPath
+			changeSets = append(changeSets, changeSet)
 		}
-		changeSets = append(changeSets, changeSet)
 	}
 	c.changeSets = changeSets
 	return nil
 }
 
+func (c *mainChangeLog) getChangeSetPaths(m *MigrationFile) ([]string, custom_error.CustomError) {
+	if len(m.IncludeAll) <= 0 {
+		return []string{getFullPath(m.RelativePath, c.workingDir, c.workingDir, m.Path)}, nil
+	}
+	paths, err := expandIncludeAll(m, c.workingDir, c.workingDir)
+	if err != nil {
+		return nil, custom_error.NewErrorf(err, "Failed to include migrations from '%v'", m.IncludeAll)
+	}
+	res := make([]string, 0, len(paths))
+	for _, fullPath := range paths {
+		if filepath.Clean(fullPath) == filepath.Clean(c.path) {
+			continue
+		}
+		res = append(res, fullPath)
+	}
+	if len(res) <= 0 {
+		return nil, custom_error.MakeErrorf("No migrations in '%v' match pattern '%v'", m.IncludeAll, m.Pattern)
+	}
+	return res, nil
+}
+
 func (c *mainChangeLog) GetConnectionString() string {
 	return c.Connection
 }
@@ -482,7 +829,7 @@ func backwardStrategy(sets []*ChangeSet, processor ChangeSetProcessor) custom_er
 	return nil
 }
 
-func NewChangeLog(path string) (ChangeLog, custom_error.CustomError) {
+func readMainChangeLog(path string, strategy ChangeSetApplyStrategy, properties Properties) (*mainChangeLog, custom_error.CustomError) {
 	if len(path) <= 0 {
 		return nil, custom_error.MakeErrorf("Input changelog path is empty. Internal error.")
 	}
@@ -491,41 +838,49 @@ func NewChangeLog(path string) (ChangeLog, custom_error.CustomError) {
 	if err != nil {
 		return nil, custom_error.MakeErrorf("Failed to open changelog file. Error: %v", err)
 	}
+	changeLogData, source, errValue := properties.Substitute(path, changeLogData)
+	if errValue != nil {
+		return nil, custom_error.NewErrorf(errValue, "Failed to read changelog")
+	}
+	changeLogData, errValue = decoding.ToJSON(path, changeLogData)
+	if errValue != nil {
+		return nil, custom_error.NewErrorf(errValue, "Failed to read changelog")
+	}
 	changeLog := mainChangeLog{
+		path:       path,
+		properties: properties,
 		workingDir: filepath.Dir(path),
-		strategy:   forwardStrategy,
+		strategy:   strategy,
 	}
 	err = json.Unmarshal(changeLogData, &changeLog)
 	if err != nil {
-		return nil, custom_error.MakeErrorf("Failed to unmarshal changelog. Error: %v", err)
-	}
-	errValue := changeLog.validate()
-	if errValue != nil {
-		return nil, custom_error.NewErrorf(errValue, "Changelog validation failed")
+		return nil, custom_error.NewErrorf(decoding.NewJSONError(path, changeLogData, source, err), "Failed to unmarshal changelog")
 	}
 	return &changeLog, nil
 }
 
-func NewRollbackChangeLog(path string) (ChangeLog, custom_error.CustomError) {
-	if len(path) <= 0 {
-		return nil, custom_error.MakeErrorf("Input changelog path is empty. Internal error.")
-	}
-
-	changeLogData, err := ioutil.ReadFile(path)
-	if err != nil {
-		return nil, custom_error.MakeErrorf("Failed to open changelog file. Error: %v", err)
-	}
-	changeLog := mainChangeLog{
-		workingDir: filepath.Dir(path),
-		strategy:   backwardStrategy,
-	}
-	err = json.Unmarshal(changeLogData, &changeLog)
-	if err != nil {
-		return nil, custom_error.MakeErrorf("Failed to unmarshal changelog. Error: %v", err)
+func newChangeLog(path string, strategy ChangeSetApplyStrategy, properties Properties) (ChangeLog, custom_error.CustomError) {
+	changeLog, errValue := readMainChangeLog(path, strategy, properties)
+	if errValue != nil {
+		return nil, errValue
 	}
-	errValue := changeLog.validate()
+	errValue = changeLog.validate(&strictVisitor{})
 	if errValue != nil {
 		return nil, custom_error.NewErrorf(errValue, "Changelog validation failed")
 	}
-	return &changeLog, nil
+	return changeLog, nil
+}
+
+func NewChangeLog(path string, properties Properties) (ChangeLog, custom_error.CustomError) {
+	return newChangeLog(path, forwardStrategy, properties)
+}
+
+func NewRollbackChangeLog(path string, properties Properties) (ChangeLog, custom_error.CustomError) {
+	return newChangeLog(path, backwardStrategy, properties)
+}
+
+// NewConnectionSettings reads main changelog without loading its migrations, so recovery commands work, while some
+// migration can't be loaded.
+func NewConnectionSettings(path string, properties Properties) (ConnectionSettings, custom_error.CustomError) {
+	return readMainChangeLog(path, forwardStrategy, properties)
 }
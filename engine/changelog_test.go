@@ -0,0 +1,48 @@
+package engine
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "mongol-changelog")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatalf("Failed to create directory for '%v': %v", name, err)
+		}
+		err = ioutil.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatalf("Failed to write '%v': %v", name, err)
+		}
+	}
+	return dir
+}
+
+func TestConnectionSettingsIgnoreBrokenMigrations(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"changelog.json": `{"connection": "mongodb://localhost:27017", "dbname": "mongol", "migrations": [{"include": "set.json", "relativeToChangelogFile": true}]}`,
+		"set.json":       `{"id": "set", "changes": [{"migration": "broken.json"}]}`,
+		"broken.json":    `{"insert": "${UNDEFINED}"`,
+	})
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "changelog.json")
+	_, err := NewChangeLog(path, Properties{})
+	if err == nil {
+		t.Fatalf("Expected changelog with broken migration to fail")
+	}
+	settings, err := NewConnectionSettings(path, Properties{})
+	if err != nil {
+		t.Fatalf("Failed to read connection settings: %v", err)
+	}
+	if settings.GetConnectionString() != "mongodb://localhost:27017" || settings.GetDBName() != "mongol" {
+		t.Errorf("Unexpected connection settings: %v, %v", settings.GetConnectionString(), settings.GetDBName())
+	}
+}
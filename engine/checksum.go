@@ -0,0 +1,103 @@
+package engine
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+
+	"github.com/coldze/mongol/engine/decoding"
+	"github.com/coldze/primitives/custom_error"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	CHECKSUM_VERSION_PREFIX = "v2:sha256:"
+)
+
+// lineEndingWriter converts CRLF into LF, so checksums of text files don't depend on platform, they were saved on.
+type lineEndingWriter struct {
+	out            io.Writer
+	carriageReturn bool
+}
+
+func (w *lineEndingWriter) Write(data []byte) (int, error) {
+	converted := make([]byte, 0, len(data)+1)
+	for _, c := range data {
+		if w.carriageReturn && c != '\n' {
+			converted = append(converted, '\r')
+		}
+		w.carriageReturn = c == '\r'
+		if !w.carriageReturn {
+			converted = append(converted, c)
+		}
+	}
+	_, err := w.out.Write(converted)
+	if err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// ChangeChecksum accumulates both checksums of change: versioned one, calculated over canonical BSON of every command,
+// and legacy MD5 of files, so changes applied by previous versions still verify.
+type ChangeChecksum struct {
+	legacy    hash.Hash
+	canonical hash.Hash
+}
+
+func (c *ChangeChecksum) writeCanonicalText(data []byte) {
+	writer := &lineEndingWriter{out: c.canonical}
+	writer.Write(data)
+}
+
+// textWriter is used for content, that can't be decoded into commands: JavaScript migrations and data files.
+func (c *ChangeChecksum) textWriter() io.Writer {
+	return io.MultiWriter(c.legacy, &lineEndingWriter{out: c.canonical})
+}
+
+func (c *ChangeChecksum) writeCommands(commands []interface{}) custom_error.CustomError {
+	for i := range commands {
+		data, err := bson.Marshal(bson.D{{Key: "cmd", Value: commands[i]}})
+		if err != nil {
+			return custom_error.MakeErrorf("Failed to encode command #%v for checksum. Error: %v", i, err)
+		}
+		c.canonical.Write(data)
+	}
+	return nil
+}
+
+// writeMigration hashes commands, decoded from file before properties are substituted, so checksums don't depend on
+// property values, same as legacy ones. Files, that are not valid without properties (e.g. unquoted `${COUNT}`),
+// are hashed as text.
+func (c *ChangeChecksum) writeMigration(path string, rawContent []byte) custom_error.CustomError {
+	canonicalText := decoding.CanonicalJSONC(path, rawContent)
+	c.legacy.Write(canonicalText)
+	jsonContent, err := decoding.ToJSON(path, rawContent)
+	if err != nil {
+		c.writeCanonicalText(canonicalText)
+		return nil
+	}
+	commands, err := decoding.DecodeMigrationCommands(path, jsonContent, nil)
+	if err != nil {
+		c.writeCanonicalText(canonicalText)
+		return nil
+	}
+	return c.writeCommands(commands)
+}
+
+func (c *ChangeChecksum) Legacy() string {
+	return hex.EncodeToString(c.legacy.Sum(nil))
+}
+
+func (c *ChangeChecksum) Value() string {
+	return CHECKSUM_VERSION_PREFIX + hex.EncodeToString(c.canonical.Sum(nil))
+}
+
+func NewChangeChecksum() *ChangeChecksum {
+	return &ChangeChecksum{
+		legacy:    md5.New(),
+		canonical: sha256.New(),
+	}
+}
@@ -0,0 +1,92 @@
+package engine
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func loadChecksums(t *testing.T, dir string, name string, content string) (*Change, error) {
+	err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write migration: %v", err)
+	}
+	changeFile := &ChangeFile{
+		Forward:  []*MigrationFile{{Path: name}},
+		Backward: []*MigrationFile{},
+	}
+	change, errValue := NewChange(changeFile, dir, dir, "change", Properties{})
+	if errValue != nil {
+		return nil, errValue
+	}
+	return change, nil
+}
+
+func TestChecksumIgnoresFormatting(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mongol-checksum")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	variants := []struct {
+		name    string
+		content string
+	}{
+		{"migration.json", `{"insert": "users", "documents": [{"_id": {"$oid": "5d92a2f0a7b11b0001a1b2d1"}, "at": {"$date": "2019-10-01T00:00:00Z"}}]}`},
+		{"migration.json", "{\r\n    \"insert\": \"users\",\r\n    \"documents\": [\r\n        {\"_id\": {\"$oid\": \"5d92a2f0a7b11b0001a1b2d1\"}, \"at\": {\"$date\": \"2019-10-01T00:00:00Z\"}}\r\n    ]\r\n}\r\n"},
+		{"migration.json", "// seed\n{\"insert\": \"users\", \"documents\": [{\"_id\": {\"$oid\": \"5d92a2f0a7b11b0001a1b2d1\"}, \"at\": {\"$date\": \"2019-10-01T00:00:00Z\"}},]}"},
+		{"migration.mongo", `{insert: 'users', documents: [{_id: ObjectId("5d92a2f0a7b11b0001a1b2d1"), at: ISODate("2019-10-01T00:00:00Z")}]}`},
+	}
+	expected := ""
+	for i, variant := range variants {
+		for load := 0; load < 2; load++ {
+			change, err := loadChecksums(t, dir, variant.name, variant.content)
+			if err != nil {
+				t.Fatalf("Failed to load variant #%v: %v", i, err)
+			}
+			if !strings.HasPrefix(change.Hash, CHECKSUM_VERSION_PREFIX) {
+				t.Fatalf("Unversioned checksum: %v", change.Hash)
+			}
+			if len(expected) <= 0 {
+				expected = change.Hash
+			}
+			if change.Hash != expected {
+				t.Errorf("Variant #%v, load #%v: checksum %v, expected %v", i, load, change.Hash, expected)
+			}
+		}
+	}
+}
+
+func TestChecksumRejectsGeneratedValues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mongol-checksum")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	_, err = loadChecksums(t, dir, "migration.mongo", `{insert: 'users', documents: [{_id: ObjectId()}]}`)
+	if err == nil {
+		t.Fatalf("Expected migration with ObjectId() to be rejected")
+	}
+}
+
+func TestLegacyChecksum(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mongol-checksum")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	change, err := loadChecksums(t, dir, "migration.json", `{"insert": "users", "documents": [{"name": "a"}]}`)
+	if err != nil {
+		t.Fatalf("Failed to load change: %v", err)
+	}
+	// MD5 of file content, recorded by versions before checksums were versioned
+	legacy := "43822184cfb7b239252b26131209929c"
+	if change.LegacyHash != legacy {
+		t.Errorf("Legacy checksum %v, expected %v", change.LegacyHash, legacy)
+	}
+	if !change.HasChecksum(legacy) || !change.HasChecksum(change.Hash) || change.HasChecksum("0123456789abcdef0123456789abcdef") {
+		t.Errorf("Checksums are not matched. Hash: %v. Legacy: %v", change.Hash, change.LegacyHash)
+	}
+}
@@ -0,0 +1,210 @@
+package engine
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/coldze/primitives/custom_error"
+)
+
+type ContextExpression func(names map[string]struct{}) bool
+
+type contextExpressionParser struct {
+	expression string
+	tokens     []string
+	pos        int
+}
+
+func isContextNameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' || r == '.'
+}
+
+func tokenizeContextExpression(expression string) ([]string, custom_error.CustomError) {
+	tokens := []string{}
+	runes := []rune(expression)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')' || r == '!' || r == ',':
+			tokens = append(tokens, string(r))
+			i++
+		case isContextNameRune(r):
+			start := i
+			for i < len(runes) && isContextNameRune(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, strings.ToLower(string(runes[start:i])))
+		default:
+			return nil, custom_error.MakeErrorf("Unexpected character '%c' at position %v", r, i)
+		}
+	}
+	return tokens, nil
+}
+
+func (p *contextExpressionParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *contextExpressionParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func (p *contextExpressionParser) parseOr() (ContextExpression, custom_error.CustomError) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "or" || p.peek() == "," {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(names map[string]struct{}) bool {
+			return l(names) || right(names)
+		}
+	}
+	return left, nil
+}
+
+func (p *contextExpressionParser) parseAnd() (ContextExpression, custom_error.CustomError) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "and" {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(names map[string]struct{}) bool {
+			return l(names) && right(names)
+		}
+	}
+	return left, nil
+}
+
+func (p *contextExpressionParser) parseNot() (ContextExpression, custom_error.CustomError) {
+	if p.peek() == "!" || p.peek() == "not" {
+		p.next()
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return func(names map[string]struct{}) bool {
+			return !operand(names)
+		}, nil
+	}
+	return p.parseOperand()
+}
+
+func (p *contextExpressionParser) parseOperand() (ContextExpression, custom_error.CustomError) {
+	token := p.next()
+	switch token {
+	case "":
+		return nil, custom_error.MakeErrorf("Unexpected end of expression '%v'", p.expression)
+	case "(":
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, custom_error.MakeErrorf("Missing ')' in expression '%v'", p.expression)
+		}
+		return inner, nil
+	case ")", "!", ",", "and", "or", "not":
+		return nil, custom_error.MakeErrorf("Unexpected '%v' in expression '%v'", token, p.expression)
+	}
+	return func(names map[string]struct{}) bool {
+		_, ok := names[token]
+		return ok
+	}, nil
+}
+
+// ParseContextExpression parses expressions like "dev and !perf" or "(dev or test), qa".
+// Empty expression matches everything.
+func ParseContextExpression(expression string) (ContextExpression, custom_error.CustomError) {
+	tokens, err := tokenizeContextExpression(expression)
+	if err != nil {
+		return nil, custom_error.NewErrorf(err, "Failed to parse contexts expression '%v'", expression)
+	}
+	if len(tokens) <= 0 {
+		return func(names map[string]struct{}) bool {
+			return true
+		}, nil
+	}
+	parser := &contextExpressionParser{
+		expression: expression,
+		tokens:     tokens,
+	}
+	result, err := parser.parseOr()
+	if err != nil {
+		return nil, custom_error.NewErrorf(err, "Failed to parse contexts expression")
+	}
+	if parser.pos < len(tokens) {
+		return nil, custom_error.MakeErrorf("Unexpected '%v' in contexts expression '%v'", parser.peek(), expression)
+	}
+	return result, nil
+}
+
+func splitContextNames(value string) []string {
+	names := []string{}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if len(name) > 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+type contextFilter struct {
+	matches   ContextExpression
+	processor ChangeSetProcessor
+}
+
+func (c *contextFilter) Process(changeSet *ChangeSet) custom_error.CustomError {
+	if len(changeSet.Contexts) <= 0 && len(changeSet.Labels) <= 0 {
+		return c.processor.Process(changeSet)
+	}
+	names := map[string]struct{}{}
+	for _, name := range changeSet.Contexts {
+		names[name] = struct{}{}
+	}
+	for _, name := range changeSet.Labels {
+		names[name] = struct{}{}
+	}
+	if !c.matches(names) {
+		return nil
+	}
+	return c.processor.Process(changeSet)
+}
+
+// NewContextFilter skips change sets, which contexts and labels don't match the expression.
+// Change sets without contexts and labels are always processed.
+func NewContextFilter(expression string, processor ChangeSetProcessor) (ChangeSetProcessor, custom_error.CustomError) {
+	if processor == nil {
+		return nil, custom_error.MakeErrorf("Empty processor provided")
+	}
+	if len(strings.TrimSpace(expression)) <= 0 {
+		return processor, nil
+	}
+	matches, err := ParseContextExpression(expression)
+	if err != nil {
+		return nil, custom_error.NewErrorf(err, "Failed to create context filter")
+	}
+	return &contextFilter{
+		matches:   matches,
+		processor: processor,
+	}, nil
+}
@@ -0,0 +1,77 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseContextExpression(t *testing.T) {
+	cases := []struct {
+		expression string
+		names      string
+		expected   bool
+	}{
+		{"", "", true},
+		{"dev", "dev", true},
+		{"dev", "test", false},
+		{"DEV", "dev", true},
+		{"!dev", "dev", false},
+		{"not dev", "test", true},
+		{"!!dev", "dev", true},
+		{"dev and test", "dev", false},
+		{"dev and test", "dev,test", true},
+		{"dev or test", "test", true},
+		{"dev, test", "test", true},
+		{"dev or test and perf", "dev", true},
+		{"dev or test and perf", "test", false},
+		{"(dev or test) and perf", "dev", false},
+		{"(dev or test) and perf", "test,perf", true},
+		{"dev and !perf", "dev,perf", false},
+		{"dev and !perf", "dev", true},
+		{"!dev and perf", "perf", true},
+		{"!(dev and perf)", "dev,perf", false},
+		{"!(dev and perf)", "dev", true},
+		{"not dev or perf", "dev,perf", true},
+		{"dev and test or perf", "perf", true},
+		{"dev and (test or perf)", "perf", false},
+	}
+	for _, c := range cases {
+		matches, err := ParseContextExpression(c.expression)
+		if err != nil {
+			t.Errorf("'%v': failed to parse: %v", c.expression, err)
+			continue
+		}
+		names := map[string]struct{}{}
+		for _, name := range splitContextNames(c.names) {
+			names[name] = struct{}{}
+		}
+		if matches(names) != c.expected {
+			t.Errorf("'%v' for [%v]: expected %v", c.expression, c.names, c.expected)
+		}
+	}
+}
+
+func TestParseContextExpressionErrors(t *testing.T) {
+	cases := []struct {
+		expression string
+		message    string
+	}{
+		{"dev and", "Unexpected end of expression"},
+		{"!", "Unexpected end of expression"},
+		{"(dev or test", "Missing ')'"},
+		{"dev)", "Unexpected ')'"},
+		{"dev test", "Unexpected 'test'"},
+		{"or dev", "Unexpected 'or'"},
+		{"dev & test", "Unexpected character '&'"},
+	}
+	for _, c := range cases {
+		_, err := ParseContextExpression(c.expression)
+		if err == nil {
+			t.Errorf("'%v': expected error", c.expression)
+			continue
+		}
+		if !strings.Contains(err.Error(), c.message) {
+			t.Errorf("'%v': expected error with '%v', got: %v", c.expression, c.message, err)
+		}
+	}
+}
@@ -1,24 +1,16 @@
 package decoding
 
 import (
-	"github.com/coldze/primitives/custom_error"
-	"go.mongodb.org/mongo-driver/bson/primitive"
+	"bytes"
+	"math"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
-)
+	"unicode/utf8"
 
-const (
-	TYPE_UNKNOWN = iota
-	TYPE_NULL
-	TYPE_BOOLEAN
-	TYPE_INT32
-	TYPE_INT64
-	TYPE_FLOAT64
-	TYPE_DECIMAL128
-	TYPE_STRING
-	TYPE_ARRAY
-	TYPE_OBJECT
+	"github.com/coldze/primitives/custom_error"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 const (
@@ -26,10 +18,15 @@ const (
 	SYMBOL_CURL_BRACER_CLOSE = '}'
 	SYMBOL_BRACER_OPEN       = '['
 	SYMBOL_BRACER_CLOSE      = ']'
+	SYMBOL_PARENTHESIS_OPEN  = '('
+	SYMBOL_PARENTHESIS_CLOSE = ')'
 	SYMBOL_COMMA             = ','
 	SYMBOL_DOUBLE_DOT        = ':'
+	SYMBOL_SEMICOLON         = ';'
 	SYMBOL_QUOTE             = '"'
+	SYMBOL_SINGLE_QUOTE      = '\''
 	SYMBOL_SLASH             = '/'
+	SYMBOL_ASTERISK          = '*'
 	SYMBOL_BACKSLASH         = '\\'
 	SYMBOL_SPACE             = ' '
 	SYMBOL_TAB               = '\t'
@@ -37,507 +34,575 @@ const (
 	SYMBOL_CARRIAGE_RETURN   = '\r'
 )
 
-type Object struct {
-	TypedValue interface{}
-	RawValue   []byte
-	Type       int64
+// Constructors without arguments produce new value on every load: checksum and generated rollback would never match
+// what was applied.
+const noArgumentsError = "Value must be specified explicitly, constructor without arguments generates new value on every load"
+
+var shellDateFormats = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999-0700",
+	"2006-01-02",
 }
 
-func Decode(data []byte) (interface{}, custom_error.CustomError) {
-	res, _, err := parseAny(data)
-	if err != nil {
-		return nil, custom_error.NewErrorf(err, "Failed to decode data")
+type parsingFunc func(p *shellParser) (interface{}, custom_error.CustomError)
+
+// shellFunctions are constructors of mongo shell. Lower-case names are kept for files, written for the first version of decoder.
+var shellFunctions = map[string]parsingFunc{
+	"ObjectId":      parseObjectID,
+	"objectID":      parseObjectID,
+	"ISODate":       parseDatetime,
+	"Date":          parseDatetime,
+	"datetime":      parseDatetime,
+	"NumberLong":    parseInt64,
+	"int64":         parseInt64,
+	"NumberInt":     parseInt32,
+	"int32":         parseInt32,
+	"NumberDecimal": parseDecimal128,
+	"decimal128":    parseDecimal128,
+	"Timestamp":     parseTimestamp,
+	"timestamp":     parseTimestamp,
+}
+
+var shellConstants = map[string]interface{}{
+	"true":   true,
+	"false":  false,
+	"null":   nil,
+	"MinKey": primitive.MinKey{},
+	"MaxKey": primitive.MaxKey{},
+}
+
+func IsShellSyntax(path string) bool {
+	return strings.ToLower(filepath.Ext(path)) == ".mongo"
+}
+
+// shellParser decodes mongo shell syntax (unquoted keys, single-quoted strings, comments, ObjectId(...), ISODate(...), etc.)
+// into the same values, Extended JSON decoder produces: primitive.D, primitive.A, int32/int64/float64, primitive.DateTime, etc.
+type shellParser struct {
+	data     []byte
+	pos      int
+	errorPos int
+}
+
+func (p *shellParser) fail(format string, args ...interface{}) custom_error.CustomError {
+	if p.errorPos < 0 {
+		p.errorPos = p.pos
 	}
-	return res, nil
+	return custom_error.MakeErrorf(format, args...)
+}
+
+func (p *shellParser) skipEmpty() {
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		switch {
+		case c == SYMBOL_SPACE || c == SYMBOL_TAB || c == SYMBOL_NEW_LINE || c == SYMBOL_CARRIAGE_RETURN:
+			p.pos++
+		case c == SYMBOL_SLASH && p.pos+1 < len(p.data) && p.data[p.pos+1] == SYMBOL_SLASH:
+			end := bytes.IndexByte(p.data[p.pos:], SYMBOL_NEW_LINE)
+			if end < 0 {
+				p.pos = len(p.data)
+				return
+			}
+			p.pos += end + 1
+		case c == SYMBOL_SLASH && p.pos+1 < len(p.data) && p.data[p.pos+1] == SYMBOL_ASTERISK:
+			end := bytes.Index(p.data[p.pos+2:], []byte("*/"))
+			if end < 0 {
+				p.pos = len(p.data)
+				return
+			}
+			p.pos += end + 4
+		default:
+			return
+		}
+	}
+}
+
+func (p *shellParser) peek() (byte, bool) {
+	p.skipEmpty()
+	if p.pos >= len(p.data) {
+		return 0, false
+	}
+	return p.data[p.pos], true
+}
+
+func (p *shellParser) expect(symbol byte) custom_error.CustomError {
+	c, ok := p.peek()
+	if !ok {
+		return p.fail("Unexpected end of data, expected '%c'", symbol)
+	}
+	if c != symbol {
+		return p.fail("Unexpected '%c', expected '%c'", c, symbol)
+	}
+	p.pos++
+	return nil
+}
+
+func isIdentifierSymbol(c byte, first bool) bool {
+	if c == '_' || c == '$' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') {
+		return true
+	}
+	return !first && (('0' <= c && c <= '9') || c == '.')
 }
 
-func collectEscapedString(data []byte) (int, custom_error.CustomError) {
+func (p *shellParser) extractIdentifier() string {
+	start := p.pos
+	for p.pos < len(p.data) && isIdentifierSymbol(p.data[p.pos], p.pos == start) {
+		p.pos++
+	}
+	return string(p.data[start:p.pos])
+}
+
+func collectEscapedString(data []byte) (rune, int, custom_error.CustomError) {
 	if len(data) <= 0 {
-		return 0, custom_error.MakeErrorf("Escaped sequence wrong fromat")
+		return 0, 0, custom_error.MakeErrorf("Escaped sequence wrong format")
 	}
-	c := data[0]
-	switch c {
+	switch data[0] {
 	case 'u':
-		{
-			if len(data) < 4 {
-				return 0, custom_error.MakeErrorf("Escaped sequence wrong fromat")
-			}
-			for i := 1; i < 4; i++ {
-				uniC := data[i]
-				if '0' <= uniC && uniC <= '9' || 'a' <= uniC && uniC <= 'f' || 'A' <= uniC && uniC <= 'F' {
-					continue
-				}
-				return 0, custom_error.MakeErrorf("Escaped sequence wrong fromat")
-			}
-			return 4, nil
+		if len(data) < 5 {
+			return 0, 0, custom_error.MakeErrorf("Escaped sequence wrong format")
 		}
-	case 'b', 'f', 'n', 'r', 't', SYMBOL_BACKSLASH, SYMBOL_SLASH, SYMBOL_QUOTE:
-		{
-			return 1, nil
+		value, err := strconv.ParseUint(string(data[1:5]), 16, 32)
+		if err != nil {
+			return 0, 0, custom_error.MakeErrorf("Escaped sequence wrong format. Error: %v", err)
 		}
+		return rune(value), 5, nil
+	case 'b':
+		return '\b', 1, nil
+	case 'f':
+		return '\f', 1, nil
+	case 'n':
+		return '\n', 1, nil
+	case 'r':
+		return '\r', 1, nil
+	case 't':
+		return '\t', 1, nil
+	case SYMBOL_BACKSLASH, SYMBOL_SLASH, SYMBOL_QUOTE, SYMBOL_SINGLE_QUOTE:
+		return rune(data[0]), 1, nil
 	}
-	return 0, custom_error.MakeErrorf("Escaped sequence wrong fromat")
+	return 0, 0, custom_error.MakeErrorf("Escaped sequence wrong format")
 }
 
-func extractString(in []byte, ending byte) (*string, []byte, custom_error.CustomError) {
-	data := in
-	max := len(data)
-	if max <= 0 {
-		return nil, nil, custom_error.MakeErrorf("Invalid format")
-	}
-	i := 0
-	for {
-		c := data[i]
+func (p *shellParser) extractString() (string, custom_error.CustomError) {
+	ending, ok := p.peek()
+	if !ok || (ending != SYMBOL_QUOTE && ending != SYMBOL_SINGLE_QUOTE) {
+		return "", p.fail("Expected string")
+	}
+	p.pos++
+	res := strings.Builder{}
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
 		switch {
 		case c == ending:
-			{
-				v := string(data[0:i])
-				return &v, data[i+1:], nil
-			}
+			p.pos++
+			return res.String(), nil
 		case c == SYMBOL_BACKSLASH:
-			{
-				inc, err := collectEscapedString(data[i+1:])
-				if err != nil {
-					return nil, nil, custom_error.NewErrorf(err, "Escaped sequence parsing failed.")
+			value, length, err := collectEscapedString(p.data[p.pos+1:])
+			if err != nil {
+				return "", p.fail("%v", err)
+			}
+			if utf16Surrogate(value) {
+				low, lowLength, ok := p.lowSurrogate(p.pos + 1 + length)
+				if ok {
+					value = utf16Decode(value, low)
+					length += lowLength
 				}
-				i += inc
 			}
+			res.WriteRune(value)
+			p.pos += 1 + length
 		case c < 0x20:
-			{
-
-			}
-		}
-		i++
-		if i >= max {
-			return nil, nil, custom_error.MakeErrorf("Invalid format")
+			return "", p.fail("Control character in string")
+		default:
+			value, size := utf8.DecodeRune(p.data[p.pos:])
+			res.WriteRune(value)
+			p.pos += size
 		}
 	}
-	return nil, nil, custom_error.MakeErrorf("Invalid format")
+	return "", p.fail("Unterminated string")
 }
 
-func parseString(in []byte) (interface{}, []byte, custom_error.CustomError) {
-	v, data, err := extractString(in, SYMBOL_QUOTE)
-	if err != nil {
-		return nil, nil, custom_error.NewErrorf(err, "Failed to parse string")
+func utf16Surrogate(value rune) bool {
+	return 0xd800 <= value && value < 0xdc00
+}
+
+func utf16Decode(high rune, low rune) rune {
+	return (high-0xd800)<<10 + (low - 0xdc00) + 0x10000
+}
+
+func (p *shellParser) lowSurrogate(pos int) (rune, int, bool) {
+	if pos+1 >= len(p.data) || p.data[pos] != SYMBOL_BACKSLASH || p.data[pos+1] != 'u' {
+		return 0, 0, false
 	}
-	if v == nil {
-		return nil, nil, custom_error.MakeErrorf("Failed to parse string: empty data")
+	value, length, err := collectEscapedString(p.data[pos+1:])
+	if err != nil || value < 0xdc00 || value >= 0xe000 {
+		return 0, 0, false
 	}
-	return *v, data, err
+	return value, length + 1, true
 }
 
-func extractNumber(in []byte) (*string, []byte, custom_error.CustomError) {
-	data := skipEmpty(in)
-	max := len(data)
-	if max <= 0 {
-		return nil, nil, custom_error.MakeErrorf("Invalid format")
-	}
-	for i, v := range data {
-		if (v >= '0') && (v <= '9') {
+func (p *shellParser) extractNumber() (string, bool, custom_error.CustomError) {
+	p.skipEmpty()
+	start := p.pos
+	integer := true
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		if '0' <= c && c <= '9' {
+			p.pos++
 			continue
 		}
-		if (v == 'E') || (v == 'e') || (v == '.') || (v == '+') || (v == '-') {
+		if c == 'E' || c == 'e' || c == '.' {
+			integer = false
+			p.pos++
 			continue
 		}
-		s := string(data[:i])
-		return &s, data[i:], nil
+		if c == '+' || c == '-' {
+			p.pos++
+			continue
+		}
+		break
+	}
+	if start == p.pos {
+		return "", false, p.fail("Expected number")
 	}
-	return nil, nil, custom_error.MakeErrorf("Invalid format")
+	return string(p.data[start:p.pos]), integer, nil
 }
 
-func parseNumber(in []byte) (interface{}, []byte, custom_error.CustomError) {
-	s, data, errValue := extractNumber(in)
+// parseNumber follows Extended JSON decoder: integers are int32, when they fit, otherwise int64, other numbers are double.
+func parseNumber(p *shellParser) (interface{}, custom_error.CustomError) {
+	start := p.pos
+	value, integer, errValue := p.extractNumber()
 	if errValue != nil {
-		return nil, nil, custom_error.NewErrorf(errValue, "Failed to parse number")
+		return nil, errValue
 	}
-	floatValue, err := strconv.ParseFloat(*s, 10)
+	if integer {
+		intValue, err := strconv.ParseInt(value, 10, 64)
+		if err == nil {
+			if intValue >= math.MinInt32 && intValue <= math.MaxInt32 {
+				return int32(intValue), nil
+			}
+			return intValue, nil
+		}
+	}
+	floatValue, err := strconv.ParseFloat(value, 64)
 	if err != nil {
-		return nil, nil, custom_error.NewErrorf(custom_error.MakeError(err), "Failed to parse number")
+		p.pos = start
+		return nil, p.fail("Invalid number '%v'. Error: %v", value, err)
 	}
-	return floatValue, data, nil
+	return floatValue, nil
 }
 
-func parseDatetime(in []byte) (interface{}, []byte, custom_error.CustomError) {
-	dateStr, data, err := extractString(in, ')')
-	if err != nil {
-		return nil, nil, custom_error.NewErrorf(err, "Failed to parse date-time")
-	}
-	if dateStr == nil {
-		return nil, nil, custom_error.MakeErrorf("Failed to parse date-time. Empty data")
-	}
-	parts := strings.Split(*dateStr, ",")
-	var format string
-	switch len(parts) {
-	case 1:
-		{
-			format = time.RFC3339
+// parseStringOrNumber reads argument of NumberLong(...), NumberInt(...), etc., which can be quoted or not.
+func (p *shellParser) parseStringOrNumber() (string, custom_error.CustomError) {
+	c, ok := p.peek()
+	if ok && (c == SYMBOL_QUOTE || c == SYMBOL_SINGLE_QUOTE) {
+		return p.extractString()
+	}
+	value, _, err := p.extractNumber()
+	return value, err
+}
+
+func parseDatetime(p *shellParser) (interface{}, custom_error.CustomError) {
+	c, ok := p.peek()
+	if ok && c == SYMBOL_PARENTHESIS_CLOSE {
+		return nil, p.fail(noArgumentsError)
+	}
+	if ok && c != SYMBOL_QUOTE && c != SYMBOL_SINGLE_QUOTE {
+		start := p.pos
+		millis, _, err := p.extractNumber()
+		if err != nil {
+			return nil, err
 		}
-	case 2:
-		{
-			format = strings.Trim(parts[1], " \t")
+		value, parseErr := strconv.ParseInt(millis, 10, 64)
+		if parseErr != nil {
+			p.pos = start
+			return nil, p.fail("Invalid date-time '%v'. Error: %v", millis, parseErr)
 		}
-	default:
-		{
-			return nil, nil, custom_error.MakeErrorf("Invalid format of date-time")
+		return primitive.DateTime(value), nil
+	}
+	start := p.pos
+	dateStr, err := p.extractString()
+	if err != nil {
+		return nil, err
+	}
+	formats := []string{}
+	c, ok = p.peek()
+	if ok && c == SYMBOL_COMMA {
+		p.pos++
+		format, err := p.extractString()
+		if err != nil {
+			return nil, err
 		}
+		formats = append(formats, format)
 	}
-	timeValue, errValue := time.Parse(format, strings.Trim(parts[0], " \t"))
-	if errValue != nil {
-		return nil, nil, custom_error.MakeError(err)
+	timeValue, err := ParseDate(dateStr, formats...)
+	if err != nil {
+		p.pos = start
+		return nil, p.fail("Invalid date-time '%v'", dateStr)
 	}
-	return primitive.DateTime(timeValue.Unix() / 1000000), data, nil
+	return toDateTime(timeValue), nil
 }
 
-func extractTypedInt(in []byte) (int64, []byte, custom_error.CustomError) {
-	strValue, data, err := extractNumber(in)
-	if err != nil {
-		return 0, nil, custom_error.NewErrorf(err, "Failed to parse int")
-	}
-	if strValue == nil || len(*strValue) <= 0 {
-		return 0, nil, custom_error.MakeErrorf("Failed to parse int. No data")
+// ParseDate parses argument of ISODate(...) using formats or, if none given, formats accepted by mongo shell.
+func ParseDate(value string, formats ...string) (time.Time, custom_error.CustomError) {
+	if len(formats) == 0 {
+		formats = shellDateFormats
 	}
-	intValue, errValue := strconv.ParseInt(*strValue, 10, 64)
-	if errValue != nil {
-		return 0, nil, custom_error.NewErrorf(custom_error.MakeError(errValue), "Failed to parse int.")
+	for _, format := range formats {
+		timeValue, err := time.Parse(format, value)
+		if err == nil {
+			return timeValue, nil
+		}
 	}
-	return intValue, data, nil
+	return time.Time{}, custom_error.MakeErrorf("Invalid date-time '%v'", value)
 }
 
-func parseInt64(in []byte) (interface{}, []byte, custom_error.CustomError) {
-	res, data, err := extractTypedInt(in)
+func toDateTime(value time.Time) primitive.DateTime {
+	return primitive.DateTime(value.Unix()*1000 + int64(value.Nanosecond()/int(time.Millisecond)))
+}
+
+func extractTypedInt(p *shellParser, bitSize int) (int64, custom_error.CustomError) {
+	start := p.pos
+	value, err := p.parseStringOrNumber()
 	if err != nil {
-		return nil, nil, custom_error.NewErrorf(err, "Failed to parse int64")
+		return 0, err
 	}
-	return res, data, nil
+	intValue, errValue := strconv.ParseInt(value, 10, bitSize)
+	if errValue != nil {
+		p.pos = start
+		return 0, p.fail("Invalid %v-bit integer '%v'. Error: %v", bitSize, value, errValue)
+	}
+	return intValue, nil
+}
+
+func parseInt64(p *shellParser) (interface{}, custom_error.CustomError) {
+	return extractTypedInt(p, 64)
 }
 
-func parseInt32(in []byte) (interface{}, []byte, custom_error.CustomError) {
-	res, data, err := extractTypedInt(in)
+func parseInt32(p *shellParser) (interface{}, custom_error.CustomError) {
+	value, err := extractTypedInt(p, 32)
 	if err != nil {
-		return nil, nil, custom_error.NewErrorf(err, "Failed to parse int64")
+		return nil, err
 	}
-	return int32(res), data, nil
+	return int32(value), nil
 }
 
-func parseDecimal128(in []byte) (interface{}, []byte, custom_error.CustomError) {
-	strValue, data, err := extractString(in, ')')
+func parseDecimal128(p *shellParser) (interface{}, custom_error.CustomError) {
+	start := p.pos
+	value, err := p.parseStringOrNumber()
 	if err != nil {
-		return nil, nil, custom_error.NewErrorf(err, "Failed to parse decimal128")
+		return nil, err
 	}
-	if strValue == nil || len(*strValue) <= 0 {
-		return nil, nil, custom_error.MakeErrorf("Failed to parse decimal128. No data")
-	}
-	decimalValue, errValue := primitive.ParseDecimal128(*strValue)
+	decimalValue, errValue := primitive.ParseDecimal128(value)
 	if errValue != nil {
-		return nil, nil, custom_error.NewErrorf(custom_error.MakeError(errValue), "Failed to parse decimal128")
+		p.pos = start
+		return nil, p.fail("Invalid decimal128 '%v'. Error: %v", value, errValue)
 	}
-	return decimalValue, data, nil
+	return decimalValue, nil
 }
 
-func parseTimestamp(in []byte) (interface{}, []byte, custom_error.CustomError) {
-	p1, data, err := extractNumber(in)
+func parseTimestamp(p *shellParser) (interface{}, custom_error.CustomError) {
+	t, err := extractTypedInt(p, 64)
 	if err != nil {
-		return nil, nil, custom_error.NewErrorf(err, "Failed to parse timestamp")
+		return nil, err
 	}
-	if p1 == nil {
-		return nil, nil, custom_error.MakeErrorf("Invalid format")
+	err = p.expect(SYMBOL_COMMA)
+	if err != nil {
+		return nil, err
 	}
-	p1value, errValue := strconv.ParseUint(*p1, 10, 32)
-	if errValue != nil {
-		return nil, nil, custom_error.MakeError(errValue)
+	i, err := extractTypedInt(p, 64)
+	if err != nil {
+		return nil, err
 	}
-	data = skipEmpty(data)
-	if len(data) < 1 {
-		return nil, nil, custom_error.MakeErrorf("Invalid format")
+	if t < 0 || t > math.MaxUint32 || i < 0 || i > math.MaxUint32 {
+		return nil, p.fail("Timestamp parts must be unsigned 32-bit integers")
 	}
-	if data[0] != ',' {
-		return nil, nil, custom_error.MakeErrorf("Invalid format")
+	return primitive.Timestamp{T: uint32(t), I: uint32(i)}, nil
+}
+
+func parseObjectID(p *shellParser) (interface{}, custom_error.CustomError) {
+	c, ok := p.peek()
+	if ok && c == SYMBOL_PARENTHESIS_CLOSE {
+		return nil, p.fail(noArgumentsError)
 	}
-	p2, data, err := extractNumber(data[1:])
+	start := p.pos
+	hexValue, err := p.extractString()
 	if err != nil {
-		return nil, nil, custom_error.NewErrorf(err, "Failed to parse timestamp")
+		return nil, err
 	}
-	if p2 == nil {
-		return nil, nil, custom_error.MakeErrorf("Invalid format")
-	}
-	p2value, errValue := strconv.ParseUint(*p2, 10, 32)
+	v, errValue := primitive.ObjectIDFromHex(hexValue)
 	if errValue != nil {
-		return nil, nil, custom_error.MakeError(errValue)
+		p.pos = start
+		return nil, p.fail("Invalid ObjectId '%v'. Error: %v", hexValue, errValue)
 	}
-	return primitive.Timestamp{T: uint32(p1value), I: uint32(p2value)}, data, nil
+	return v, nil
 }
 
-type parsingFunc func(in []byte) (interface{}, []byte, custom_error.CustomError)
-
-func parseSpecial(in []byte, expected string, parse parsingFunc) (interface{}, []byte, custom_error.CustomError) {
-	data := in
-	expectedLength := len(expected)
-	if len(data) < expectedLength+3 {
-		return nil, nil, custom_error.MakeErrorf("Invalid format")
-	}
-	if string(data[:expectedLength]) != expected && (data[expectedLength] != '(') {
-		return nil, nil, custom_error.MakeErrorf("Invalid format")
+func (p *shellParser) parseSpecial(name string) (interface{}, custom_error.CustomError) {
+	start := p.pos - len(name)
+	if name == "new" {
+		p.skipEmpty()
+		start = p.pos
+		name = p.extractIdentifier()
+	}
+	value, ok := shellConstants[name]
+	if ok {
+		return value, nil
+	}
+	parse, ok := shellFunctions[name]
+	if !ok {
+		p.pos = start
+		return nil, p.fail("Unknown identifier '%v'", name)
+	}
+	err := p.expect(SYMBOL_PARENTHESIS_OPEN)
+	if err != nil {
+		return nil, err
 	}
-	var v interface{}
-	var err custom_error.CustomError
-	v, data, err = parse(data[expectedLength+1:])
+	value, err = parse(p)
 	if err != nil {
-		return nil, nil, custom_error.NewErrorf(err, "Failed to parse double()")
+		return nil, custom_error.NewErrorf(err, "Failed to parse %v()", name)
 	}
-	data = skipEmpty(data)
-	if len(data) < 1 && data[0] != ')' {
-		return nil, nil, custom_error.MakeErrorf("Invalid format")
+	err = p.expect(SYMBOL_PARENTHESIS_CLOSE)
+	if err != nil {
+		return nil, err
 	}
-	return v, data[1:], nil
+	return value, nil
 }
 
-func parseObjectID(in []byte) (interface{}, []byte, custom_error.CustomError) {
-	data := skipEmpty(in)
-	if len(data) < 2 {
-		return nil, nil, custom_error.MakeErrorf("Invalid format")
-	}
-	hexValue, data, err := extractString(data[1:], ')')
-	if err != nil {
-		return nil, nil, custom_error.NewErrorf(err, "Failed to parse ObjectID")
+func (p *shellParser) parseAny() (interface{}, custom_error.CustomError) {
+	c, ok := p.peek()
+	if !ok {
+		return nil, p.fail("Unexpected end of data")
+	}
+	switch {
+	case c == SYMBOL_QUOTE || c == SYMBOL_SINGLE_QUOTE:
+		return p.extractString()
+	case c == SYMBOL_BRACER_OPEN:
+		p.pos++
+		return p.parseArray()
+	case c == SYMBOL_CURL_BRACER_OPEN:
+		p.pos++
+		return p.parseObject()
+	case c == '-' || c == '+' || c == '.' || ('0' <= c && c <= '9'):
+		return parseNumber(p)
+	case isIdentifierSymbol(c, true):
+		return p.parseSpecial(p.extractIdentifier())
+	}
+	return nil, p.fail("Unexpected '%c'", c)
+}
+
+func (p *shellParser) parseKey() (string, custom_error.CustomError) {
+	c, ok := p.peek()
+	if !ok {
+		return "", p.fail("Unexpected end of data, expected key")
 	}
-	if hexValue == nil {
-		return nil, nil, custom_error.MakeErrorf("Failed to parse ObjectID. Empty data.")
+	if c == SYMBOL_QUOTE || c == SYMBOL_SINGLE_QUOTE {
+		return p.extractString()
 	}
-	v, errValue := primitive.ObjectIDFromHex(*hexValue)
-	if errValue != nil {
-		return nil, nil, custom_error.NewErrorf(custom_error.MakeError(err), "Failed to parse ObjectID")
+	if !isIdentifierSymbol(c, true) {
+		return "", p.fail("Unexpected '%c', expected key", c)
 	}
-	return v, data, nil
+	return p.extractIdentifier(), nil
 }
 
-func parseAny(in []byte) (interface{}, []byte, custom_error.CustomError) {
-	data := skipEmpty(in)
-	if len(data) <= 0 {
-		return nil, nil, custom_error.MakeErrorf("Invalid format")
-	}
-	c := data[0]
-	var err custom_error.CustomError
-	switch c {
-	case SYMBOL_QUOTE:
-		{
-			return parseString(data[1:])
-		}
-	case 'i':
-		{
-			//int32
-			if len(data) < 5 {
-				return nil, nil, custom_error.MakeErrorf("Ivalid format")
-			}
-			if data[3] == '3' {
-				return parseSpecial(data, "int32", parseInt32)
-			}
-			if data[3] == '6' {
-				return parseSpecial(data, "int64", parseInt64)
-			}
-			return nil, nil, custom_error.MakeErrorf("Invalid format")
-			/*
-				bson.VC.Int32()
-				bson.VC.Int64()
-			*/
-		}
-	case 'd':
-		{
-			switch data[1] {
-			case 'a':
-				{
-					return parseSpecial(data, "datetime", parseDatetime)
-				}
-			case 'e':
-				{
-					return parseSpecial(data, "decimal128", parseDecimal128)
-				}
-			}
-
-			//return nil, nil, custom_error.MakeErrorf("Not implemented")
-			/*
-				bson.VC.DateTime()
-				bson.VC.Decimal128()
-			*/
-		}
-	case 'o':
-		{
-			if len(data) < 13 {
-				return nil, nil, custom_error.MakeErrorf("Invalid format")
-			}
-			return parseSpecial(data, "objectID", parseObjectID)
-			/*
-				bson.VC.ObjectID()
-			*/
+func (p *shellParser) parseObject() (interface{}, custom_error.CustomError) {
+	res := primitive.D{}
+	keys := map[string]struct{}{}
+	for {
+		c, ok := p.peek()
+		if ok && c == SYMBOL_CURL_BRACER_CLOSE {
+			p.pos++
+			return res, nil
 		}
-	case '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
-		{
-			var v interface{}
-			v, data, err = parseNumber(data[:])
-			if err != nil {
-				return nil, nil, custom_error.NewErrorf(err, "Invalid format.")
-			}
-			return v, data, nil
+		start := p.pos
+		key, err := p.parseKey()
+		if err != nil {
+			return nil, err
 		}
-	case 'f':
-		{
-			if len(data) < 5 {
-				return nil, nil, custom_error.MakeErrorf("Invalid format")
-			}
-			if string(data[:5]) == "false" {
-				return false, data[5:], nil
-			}
-			return nil, nil, custom_error.MakeErrorf("Invalid format")
+		_, ok = keys[key]
+		if ok {
+			p.pos = start
+			return nil, p.fail("Duplicated key: %v", key)
 		}
-	case 't':
-		{
-			//return nil, nil, custom_error.MakeErrorf("Not implemented")
-			/*
-				bson.VC.Timestamp()
-			*/
-			if len(data) < 4 {
-				return nil, nil, custom_error.MakeErrorf("Invalid format")
-			}
-			if data[1] == 'i' {
-				return parseSpecial(data, "timestamp", parseTimestamp)
-			}
-			if string(data[:4]) == "true" {
-				return true, data[4:], nil
-			}
-			return nil, nil, custom_error.MakeErrorf("Invalid format")
+		keys[key] = struct{}{}
+		err = p.expect(SYMBOL_DOUBLE_DOT)
+		if err != nil {
+			return nil, err
 		}
-	case 'n':
-		{
-			if len(data) < 4 {
-				return nil, nil, custom_error.MakeErrorf("Invalid format")
-			}
-			if string(data[:4]) == "null" {
-				return primitive.Null{}, data[4:], nil
-			}
-			return nil, nil, custom_error.MakeErrorf("Invalid format")
+		value, err := p.parseAny()
+		if err != nil {
+			return nil, custom_error.NewErrorf(err, "Failed to parse value of '%v'", key)
 		}
-	case SYMBOL_BRACER_OPEN:
-		{
-			return parseArray(data[1:])
+		res = append(res, primitive.E{Key: key, Value: value})
+		c, ok = p.peek()
+		if ok && c == SYMBOL_COMMA {
+			p.pos++
+			continue
 		}
-	case SYMBOL_CURL_BRACER_OPEN:
-		{
-			return parseObject(data[1:])
+		err = p.expect(SYMBOL_CURL_BRACER_CLOSE)
+		if err != nil {
+			return nil, err
 		}
-	default:
-		return nil, nil, custom_error.MakeErrorf("Invalid format")
+		return res, nil
 	}
-	return nil, in, custom_error.MakeErrorf("Not implemented")
 }
 
-func parseObject(in []byte) (interface{}, []byte, custom_error.CustomError) {
-	data := skipEmpty(in)
-	if len(data) <= 0 {
-		return nil, nil, custom_error.MakeErrorf("Invalid format")
-	}
-	if data[0] == SYMBOL_CURL_BRACER_CLOSE {
-		return map[string]interface{}{}, data[1:], nil
-	}
-	res := map[string]interface{}{}
+func (p *shellParser) parseArray() (interface{}, custom_error.CustomError) {
+	res := primitive.A{}
 	for {
-		if data[0] != SYMBOL_QUOTE {
-			return nil, nil, custom_error.MakeErrorf("Invalid format")
+		c, ok := p.peek()
+		if ok && c == SYMBOL_BRACER_CLOSE {
+			p.pos++
+			return res, nil
 		}
-		var key *string
-		var err custom_error.CustomError
-		key, data, err = extractString(data[1:], '"')
+		value, err := p.parseAny()
 		if err != nil {
-			return nil, nil, custom_error.NewErrorf(err, "Failed to parse object key")
-		}
-		if key == nil {
-			return nil, nil, custom_error.MakeErrorf("Failed to get object key")
-		}
-		data = skipEmpty(data)
-		if len(data) <= 0 {
-			return nil, nil, custom_error.MakeErrorf("Invalid format")
+			return nil, custom_error.NewErrorf(err, "Failed to parse array element #%v", len(res))
 		}
-		if data[0] != SYMBOL_DOUBLE_DOT {
-			return nil, nil, custom_error.MakeErrorf("Invalid format")
+		res = append(res, value)
+		c, ok = p.peek()
+		if ok && c == SYMBOL_COMMA {
+			p.pos++
+			continue
 		}
-		var value interface{}
-		value, data, err = parseAny(data[1:])
+		err = p.expect(SYMBOL_BRACER_CLOSE)
 		if err != nil {
-			return nil, nil, custom_error.NewErrorf(err, "Failed to parse value for key in map")
-		}
-		data = skipEmpty(data)
-		if len(data) <= 0 {
-			return nil, nil, custom_error.MakeErrorf("Invalid format")
-		}
-		_, ok := res[*key]
-		if ok {
-			return nil, nil, custom_error.MakeErrorf("Dublicated key: %v", *key)
-		}
-		res[*key] = value
-		switch data[0] {
-		case SYMBOL_CURL_BRACER_CLOSE:
-			{
-				return res, data[1:], nil
-			}
-		case SYMBOL_COMMA:
-			{
-				data = skipEmpty(data[1:])
-				if len(data) <= 0 {
-					return nil, nil, custom_error.MakeErrorf("Invalid format")
-				}
-			}
-		default:
-			return nil, nil, custom_error.MakeErrorf("Invalid format")
+			return nil, err
 		}
+		return res, nil
 	}
-	return nil, nil, custom_error.MakeErrorf("Invalid format")
-	//key, data, err := parseString(data[1:])
 }
 
-func parseArray(in []byte) (interface{}, []byte, custom_error.CustomError) {
-	data := skipEmpty(in)
-	if len(data) <= 0 {
-		return nil, nil, custom_error.MakeErrorf("Invalid format")
+func (p *shellParser) parse() (interface{}, custom_error.CustomError) {
+	res, err := p.parseAny()
+	if err != nil {
+		return nil, err
+	}
+	c, ok := p.peek()
+	if ok && c == SYMBOL_SEMICOLON {
+		p.pos++
+		c, ok = p.peek()
 	}
-	if data[0] == SYMBOL_BRACER_CLOSE {
-		return []interface{}{}, data[1:], nil
+	if ok {
+		return nil, p.fail("Unexpected '%c' after the end of document", c)
 	}
-	res := []interface{}{}
+	return res, nil
+}
 
-	for {
-		var value interface{}
-		var err custom_error.CustomError
-		value, data, err = parseAny(data)
-		if err != nil {
-			return nil, nil, custom_error.NewErrorf(err, "Invalid format")
-		}
-		data = skipEmpty(data)
-		if len(data) <= 0 {
-			return nil, nil, custom_error.MakeErrorf("Invalid format")
-		}
-		res = append(res, value)
-		switch data[0] {
-		case SYMBOL_BRACER_CLOSE:
-			{
-				return res, data[1:], nil
-			}
-		case SYMBOL_COMMA:
-			{
-				data = skipEmpty(data[1:])
-				if len(data) <= 0 {
-					return nil, nil, custom_error.MakeErrorf("Invalid format")
-				}
-				continue
-			}
-		}
-		return nil, nil, custom_error.MakeErrorf("Invalid format")
+func Decode(data []byte) (interface{}, custom_error.CustomError) {
+	parser := &shellParser{data: data, errorPos: -1}
+	res, err := parser.parse()
+	if err != nil {
+		return nil, custom_error.NewErrorf(err, "Failed to decode data")
 	}
+	return res, nil
 }
 
-func skipEmpty(data []byte) []byte {
-	for i, v := range data {
-		if (v == SYMBOL_SPACE) || (v == SYMBOL_TAB) || (v == SYMBOL_NEW_LINE) || (v == SYMBOL_CARRIAGE_RETURN) {
-			continue
-		}
-		return data[i:]
+// DecodeShell decodes mongo shell syntax, reporting errors as path:line:column.
+func DecodeShell(path string, data []byte, source *SourceMap) (interface{}, custom_error.CustomError) {
+	parser := &shellParser{data: data, errorPos: -1}
+	res, err := parser.parse()
+	if err != nil {
+		raw, offset := source.position(data, int64(parser.errorPos))
+		return nil, NewPositionErrorf(path, raw, offset, "Failed to decode shell syntax. Error: %v", err)
 	}
-	return []byte{}
+	return res, nil
 }
@@ -0,0 +1,89 @@
+package decoding
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestDecodeMatchesExtendedJSON(t *testing.T) {
+	cases := []struct {
+		name  string
+		shell string
+		ext   string
+	}{
+		{"object id", `{v: ObjectId("5d92a2f0a7b11b0001a1b2d1")}`, `{"v": {"$oid": "5d92a2f0a7b11b0001a1b2d1"}}`},
+		{"legacy object id", `{v: objectID('5d92a2f0a7b11b0001a1b2d1')}`, `{"v": {"$oid": "5d92a2f0a7b11b0001a1b2d1"}}`},
+		{"iso date", `{v: ISODate("2019-10-01T12:30:00.123Z")}`, `{"v": {"$date": "2019-10-01T12:30:00.123Z"}}`},
+		{"iso date with offset", `{v: ISODate("2019-10-01T14:30:00+02:00")}`, `{"v": {"$date": "2019-10-01T12:30:00Z"}}`},
+		{"date only", `{v: ISODate("2019-10-01")}`, `{"v": {"$date": "2019-10-01T00:00:00Z"}}`},
+		{"date", `{v: Date("2019-10-01T12:30:00Z")}`, `{"v": {"$date": "2019-10-01T12:30:00Z"}}`},
+		{"new date from milliseconds", `{v: new Date(1569933000000)}`, `{"v": {"$date": {"$numberLong": "1569933000000"}}}`},
+		{"number long", `{v: NumberLong(5000000000)}`, `{"v": {"$numberLong": "5000000000"}}`},
+		{"small number long", `{v: NumberLong("7")}`, `{"v": {"$numberLong": "7"}}`},
+		{"number int", `{v: NumberInt(7)}`, `{"v": {"$numberInt": "7"}}`},
+		{"number decimal", `{v: NumberDecimal("10.25")}`, `{"v": {"$numberDecimal": "10.25"}}`},
+		{"timestamp", `{v: Timestamp(1569933000, 1)}`, `{"v": {"$timestamp": {"t": 1569933000, "i": 1}}}`},
+		{"min and max keys", `{a: MinKey, b: MaxKey}`, `{"a": {"$minKey": 1}, "b": {"$maxKey": 1}}`},
+		{"int32", `{v: 2147483647}`, `{"v": 2147483647}`},
+		{"int64", `{v: 2147483648}`, `{"v": 2147483648}`},
+		{"negative int64", `{v: -2147483649}`, `{"v": -2147483649}`},
+		{"double", `{v: 0.5, w: 1e3}`, `{"v": 0.5, "w": 1e3}`},
+		{"literals", `{a: true, b: false, c: null}`, `{"a": true, "b": false, "c": null}`},
+		{"unquoted keys", `{_id: 1, $set: {a_b: 2, "a.b": 3}}`, `{"_id": 1, "$set": {"a_b": 2, "a.b": 3}}`},
+		{"single quotes", `{'k': 'it\'s "quoted"'}`, `{"k": "it's \"quoted\""}`},
+		{"escapes", `{v: "tab\tnew\nline é 😀"}`, `{"v": "tab\tnew\nline é 😀"}`},
+		{"comments", "// leading\n{a: 1, /* inline */ b: 2 // trailing\n}", `{"a": 1, "b": 2}`},
+		{"trailing commas", `{a: [1, 2,], b: {c: 3,},}`, `{"a": [1, 2], "b": {"c": 3}}`},
+		{"nested", `{cmds: [{insert: 'c', documents: [{_id: ObjectId("5d92a2f0a7b11b0001a1b2d1"), at: ISODate("2019-10-01T00:00:00Z")}]}]}`, `{"cmds": [{"insert": "c", "documents": [{"_id": {"$oid": "5d92a2f0a7b11b0001a1b2d1"}, "at": {"$date": "2019-10-01T00:00:00Z"}}]}]}`},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			shell, err := Decode([]byte(c.shell))
+			if err != nil {
+				t.Fatalf("Failed to decode shell syntax: %v", err)
+			}
+			ext := bson.D{}
+			errValue := bson.UnmarshalExtJSON([]byte(c.ext), false, &ext)
+			if errValue != nil {
+				t.Fatalf("Failed to decode extended json: %v", errValue)
+			}
+			if !reflect.DeepEqual(shell, ext) {
+				t.Errorf("Decoded values differ.\nshell: %#v\next:   %#v", shell, ext)
+			}
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	cases := []struct {
+		name     string
+		shell    string
+		position string
+	}{
+		{"object id without arguments", `{_id: ObjectId()}`, "x.mongo:1:16:"},
+		{"iso date without arguments", `{at: ISODate()}`, "x.mongo:1:14:"},
+		{"new date without arguments", `{at: new Date()}`, "x.mongo:1:15:"},
+		{"invalid object id", `{_id: ObjectId("xyz")}`, "x.mongo:1:16:"},
+		{"invalid date", "{\n  at: ISODate('2019-13-01')\n}", "x.mongo:2:15:"},
+		{"unknown constructor", `{v: UUID("x")}`, "x.mongo:1:5:"},
+		{"double comma", `{a: 1,, }`, "x.mongo:1:7:"},
+		{"duplicated key", `{a: 1, a: 2}`, "x.mongo:1:8:"},
+		{"int32 overflow", `{v: NumberInt(2147483648)}`, "x.mongo:1:15:"},
+		{"unterminated string", `{v: 'abc}`, "x.mongo:1:10:"},
+		{"data after document", `{a: 1} {}`, "x.mongo:1:8:"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := DecodeShell("x.mongo", []byte(c.shell), nil)
+			if err == nil {
+				t.Fatalf("Expected error")
+			}
+			if !strings.HasPrefix(err.Error(), c.position) {
+				t.Errorf("Expected error at %v, got: %v", c.position, err)
+			}
+		})
+	}
+}
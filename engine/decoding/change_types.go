@@ -0,0 +1,273 @@
+package decoding
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/coldze/primitives/custom_error"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type changeTypeExpander func(params primitive.D) ([]interface{}, custom_error.CustomError)
+
+var changeTypes = map[string]changeTypeExpander{
+	"createCollection": expandCreateCollection,
+	"dropCollection":   expandDropCollection,
+	"createIndex":      expandCreateIndex,
+	"dropIndex":        expandDropIndex,
+	"renameCollection": expandRenameCollection,
+	"renameField":      expandRenameField,
+	"addField":         expandAddField,
+	"removeField":      expandRemoveField,
+	"setValidator":     expandSetValidator,
+	"insertDocuments":  expandInsertDocuments,
+}
+
+func lookup(doc primitive.D, key string) (interface{}, bool) {
+	for i := range doc {
+		if doc[i].Key == key {
+			return doc[i].Value, true
+		}
+	}
+	return nil, false
+}
+
+func without(doc primitive.D, keys ...string) primitive.D {
+	res := primitive.D{}
+	for i := range doc {
+		skip := false
+		for _, key := range keys {
+			if doc[i].Key == key {
+				skip = true
+				break
+			}
+		}
+		if !skip {
+			res = append(res, doc[i])
+		}
+	}
+	return res
+}
+
+func getString(params primitive.D, key string) (string, custom_error.CustomError) {
+	value, ok := lookup(params, key)
+	if !ok {
+		return "", custom_error.MakeErrorf("Field '%v' is required", key)
+	}
+	str, ok := value.(string)
+	if !ok || len(str) <= 0 {
+		return "", custom_error.MakeErrorf("Field '%v' must be non-empty string. Type: %T", key, value)
+	}
+	return str, nil
+}
+
+func getDocument(params primitive.D, key string) (primitive.D, custom_error.CustomError) {
+	value, ok := lookup(params, key)
+	if !ok {
+		return nil, custom_error.MakeErrorf("Field '%v' is required", key)
+	}
+	doc, ok := value.(primitive.D)
+	if !ok {
+		return nil, custom_error.MakeErrorf("Field '%v' must be a document. Type: %T", key, value)
+	}
+	return doc, nil
+}
+
+func expandCreateCollection(params primitive.D) ([]interface{}, custom_error.CustomError) {
+	collection, err := getString(params, "collection")
+	if err != nil {
+		return nil, err
+	}
+	command := append(primitive.D{{Key: "create", Value: collection}}, without(params, "collection")...)
+	return []interface{}{command}, nil
+}
+
+func expandDropCollection(params primitive.D) ([]interface{}, custom_error.CustomError) {
+	collection, err := getString(params, "collection")
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{primitive.D{{Key: "drop", Value: collection}}}, nil
+}
+
+func getIndexName(keys primitive.D) string {
+	parts := make([]string, 0, len(keys)*2)
+	for i := range keys {
+		parts = append(parts, keys[i].Key, fmt.Sprintf("%v", keys[i].Value))
+	}
+	return strings.Join(parts, "_")
+}
+
+func expandCreateIndex(params primitive.D) ([]interface{}, custom_error.CustomError) {
+	collection, err := getString(params, "collection")
+	if err != nil {
+		return nil, err
+	}
+	keys, err := getDocument(params, "keys")
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) <= 0 {
+		return nil, custom_error.MakeErrorf("Field 'keys' must not be empty")
+	}
+	name := getIndexName(keys)
+	_, ok := lookup(params, "name")
+	if ok {
+		name, err = getString(params, "name")
+		if err != nil {
+			return nil, err
+		}
+	}
+	index := append(primitive.D{{Key: "key", Value: keys}, {Key: "name", Value: name}}, without(params, "collection", "keys", "name")...)
+	return []interface{}{primitive.D{
+		{Key: "createIndexes", Value: collection},
+		{Key: "indexes", Value: primitive.A{index}},
+	}}, nil
+}
+
+func expandDropIndex(params primitive.D) ([]interface{}, custom_error.CustomError) {
+	collection, err := getString(params, "collection")
+	if err != nil {
+		return nil, err
+	}
+	name, err := getString(params, "name")
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{primitive.D{{Key: "dropIndexes", Value: collection}, {Key: "index", Value: name}}}, nil
+}
+
+func expandRenameCollection(params primitive.D) ([]interface{}, custom_error.CustomError) {
+	collection, err := getString(params, "collection")
+	if err != nil {
+		return nil, err
+	}
+	to, err := getString(params, "to")
+	if err != nil {
+		return nil, err
+	}
+	command := append(primitive.D{{Key: "renameCollection", Value: collection}, {Key: "to", Value: to}}, without(params, "collection", "to")...)
+	return []interface{}{command}, nil
+}
+
+func newUpdateAll(collection string, filter primitive.D, update primitive.D) primitive.D {
+	return primitive.D{
+		{Key: "update", Value: collection},
+		{Key: "updates", Value: primitive.A{
+			primitive.D{{Key: "q", Value: filter}, {Key: "u", Value: update}, {Key: "multi", Value: true}},
+		}},
+	}
+}
+
+func expandRenameField(params primitive.D) ([]interface{}, custom_error.CustomError) {
+	collection, err := getString(params, "collection")
+	if err != nil {
+		return nil, err
+	}
+	field, err := getString(params, "field")
+	if err != nil {
+		return nil, err
+	}
+	to, err := getString(params, "to")
+	if err != nil {
+		return nil, err
+	}
+	filter := primitive.D{{Key: field, Value: primitive.D{{Key: "$exists", Value: true}}}}
+	update := primitive.D{{Key: "$rename", Value: primitive.D{{Key: field, Value: to}}}}
+	return []interface{}{newUpdateAll(collection, filter, update)}, nil
+}
+
+func expandAddField(params primitive.D) ([]interface{}, custom_error.CustomError) {
+	collection, err := getString(params, "collection")
+	if err != nil {
+		return nil, err
+	}
+	field, err := getString(params, "field")
+	if err != nil {
+		return nil, err
+	}
+	value, ok := lookup(params, "default")
+	if !ok {
+		return nil, custom_error.MakeErrorf("Field 'default' is required")
+	}
+	filter := primitive.D{{Key: field, Value: primitive.D{{Key: "$exists", Value: false}}}}
+	update := primitive.D{{Key: "$set", Value: primitive.D{{Key: field, Value: value}}}}
+	return []interface{}{newUpdateAll(collection, filter, update)}, nil
+}
+
+func expandRemoveField(params primitive.D) ([]interface{}, custom_error.CustomError) {
+	collection, err := getString(params, "collection")
+	if err != nil {
+		return nil, err
+	}
+	field, err := getString(params, "field")
+	if err != nil {
+		return nil, err
+	}
+	filter := primitive.D{{Key: field, Value: primitive.D{{Key: "$exists", Value: true}}}}
+	update := primitive.D{{Key: "$unset", Value: primitive.D{{Key: field, Value: ""}}}}
+	return []interface{}{newUpdateAll(collection, filter, update)}, nil
+}
+
+func expandSetValidator(params primitive.D) ([]interface{}, custom_error.CustomError) {
+	collection, err := getString(params, "collection")
+	if err != nil {
+		return nil, err
+	}
+	_, err = getDocument(params, "validator")
+	if err != nil {
+		return nil, err
+	}
+	command := append(primitive.D{{Key: "collMod", Value: collection}}, without(params, "collection")...)
+	return []interface{}{command}, nil
+}
+
+func expandInsertDocuments(params primitive.D) ([]interface{}, custom_error.CustomError) {
+	collection, err := getString(params, "collection")
+	if err != nil {
+		return nil, err
+	}
+	value, ok := lookup(params, "documents")
+	if !ok {
+		return nil, custom_error.MakeErrorf("Field 'documents' is required")
+	}
+	documents, ok := value.(primitive.A)
+	if !ok || len(documents) <= 0 {
+		return nil, custom_error.MakeErrorf("Field 'documents' must be non-empty array. Type: %T", value)
+	}
+	return []interface{}{primitive.D{{Key: "insert", Value: collection}, {Key: "documents", Value: documents}}}, nil
+}
+
+// expandChangeType turns declarative change like {"createIndex": {"collection": "users", "keys": {"email": 1}}}
+// into server commands. Raw commands are returned as is.
+func expandChangeType(command interface{}) ([]interface{}, custom_error.CustomError) {
+	doc, ok := command.(primitive.D)
+	if !ok || len(doc) != 1 {
+		return []interface{}{command}, nil
+	}
+	expand, ok := changeTypes[doc[0].Key]
+	if !ok {
+		return []interface{}{command}, nil
+	}
+	params, ok := doc[0].Value.(primitive.D)
+	if !ok {
+		return []interface{}{command}, nil
+	}
+	expanded, err := expand(params)
+	if err != nil {
+		return nil, custom_error.NewErrorf(err, "Invalid '%v' change", doc[0].Key)
+	}
+	return expanded, nil
+}
+
+func ExpandChangeTypes(commands []interface{}) ([]interface{}, custom_error.CustomError) {
+	res := make([]interface{}, 0, len(commands))
+	for i := range commands {
+		expanded, err := expandChangeType(commands[i])
+		if err != nil {
+			return nil, custom_error.NewErrorf(err, "Failed to expand command at position %v", i)
+		}
+		res = append(res, expanded...)
+	}
+	return res, nil
+}
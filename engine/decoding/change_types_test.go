@@ -0,0 +1,137 @@
+package decoding
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func decodeTestCommand(t *testing.T, ext string) bson.D {
+	doc := bson.D{}
+	err := bson.UnmarshalExtJSON([]byte(ext), false, &doc)
+	if err != nil {
+		t.Fatalf("Failed to decode extended json '%v': %v", ext, err)
+	}
+	return doc
+}
+
+func TestExpandChangeTypes(t *testing.T) {
+	cases := []struct {
+		name     string
+		change   string
+		expected []string
+	}{
+		{
+			"create collection",
+			`{"createCollection": {"collection": "users", "capped": true, "size": 1024}}`,
+			[]string{`{"create": "users", "capped": true, "size": 1024}`},
+		},
+		{
+			"drop collection",
+			`{"dropCollection": {"collection": "users"}}`,
+			[]string{`{"drop": "users"}`},
+		},
+		{
+			"create index",
+			`{"createIndex": {"collection": "users", "keys": {"email": 1, "created": -1}, "unique": true}}`,
+			[]string{`{"createIndexes": "users", "indexes": [{"key": {"email": 1, "created": -1}, "name": "email_1_created_-1", "unique": true}]}`},
+		},
+		{
+			"create named index",
+			`{"createIndex": {"collection": "users", "keys": {"email": 1}, "name": "by_email"}}`,
+			[]string{`{"createIndexes": "users", "indexes": [{"key": {"email": 1}, "name": "by_email"}]}`},
+		},
+		{
+			"drop index",
+			`{"dropIndex": {"collection": "users", "name": "by_email"}}`,
+			[]string{`{"dropIndexes": "users", "index": "by_email"}`},
+		},
+		{
+			"rename collection",
+			`{"renameCollection": {"collection": "db.users", "to": "db.people"}}`,
+			[]string{`{"renameCollection": "db.users", "to": "db.people"}`},
+		},
+		{
+			"rename field",
+			`{"renameField": {"collection": "users", "field": "mail", "to": "email"}}`,
+			[]string{`{"update": "users", "updates": [{"q": {"mail": {"$exists": true}}, "u": {"$rename": {"mail": "email"}}, "multi": true}]}`},
+		},
+		{
+			"add field",
+			`{"addField": {"collection": "users", "field": "active", "default": true}}`,
+			[]string{`{"update": "users", "updates": [{"q": {"active": {"$exists": false}}, "u": {"$set": {"active": true}}, "multi": true}]}`},
+		},
+		{
+			"remove field",
+			`{"removeField": {"collection": "users", "field": "active"}}`,
+			[]string{`{"update": "users", "updates": [{"q": {"active": {"$exists": true}}, "u": {"$unset": {"active": ""}}, "multi": true}]}`},
+		},
+		{
+			"set validator",
+			`{"setValidator": {"collection": "users", "validator": {"name": {"$type": "string"}}, "validationLevel": "moderate"}}`,
+			[]string{`{"collMod": "users", "validator": {"name": {"$type": "string"}}, "validationLevel": "moderate"}`},
+		},
+		{
+			"insert documents",
+			`{"insertDocuments": {"collection": "users", "documents": [{"_id": 1}, {"_id": 2}]}}`,
+			[]string{`{"insert": "users", "documents": [{"_id": 1}, {"_id": 2}]}`},
+		},
+		{
+			"raw command",
+			`{"insert": "users", "documents": [{"_id": 1}]}`,
+			[]string{`{"insert": "users", "documents": [{"_id": 1}]}`},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			expanded, err := ExpandChangeTypes([]interface{}{decodeTestCommand(t, c.change)})
+			if err != nil {
+				t.Fatalf("Failed to expand: %v", err)
+			}
+			expected := make([]interface{}, 0, len(c.expected))
+			for _, command := range c.expected {
+				expected = append(expected, decodeTestCommand(t, command))
+			}
+			if !reflect.DeepEqual(expanded, expected) {
+				t.Errorf("Unexpected commands.\nExpected: %v\nGot:      %v", expected, expanded)
+			}
+		})
+	}
+}
+
+func TestExpandChangeTypesErrors(t *testing.T) {
+	cases := []struct {
+		name    string
+		change  string
+		message string
+	}{
+		{"create collection without collection", `{"createCollection": {"capped": true}}`, "Field 'collection' is required"},
+		{"drop collection with empty collection", `{"dropCollection": {"collection": ""}}`, "Field 'collection' must be non-empty string"},
+		{"create index without keys", `{"createIndex": {"collection": "users"}}`, "Field 'keys' is required"},
+		{"create index with empty keys", `{"createIndex": {"collection": "users", "keys": {}}}`, "Field 'keys' must not be empty"},
+		{"create index with invalid keys", `{"createIndex": {"collection": "users", "keys": "email"}}`, "Field 'keys' must be a document"},
+		{"create index with invalid name", `{"createIndex": {"collection": "users", "keys": {"email": 1}, "name": 1}}`, "Field 'name' must be non-empty string"},
+		{"drop index without name", `{"dropIndex": {"collection": "users"}}`, "Field 'name' is required"},
+		{"rename collection without target", `{"renameCollection": {"collection": "db.users"}}`, "Field 'to' is required"},
+		{"rename field without field", `{"renameField": {"collection": "users", "to": "email"}}`, "Field 'field' is required"},
+		{"rename field without target", `{"renameField": {"collection": "users", "field": "mail"}}`, "Field 'to' is required"},
+		{"add field without default", `{"addField": {"collection": "users", "field": "active"}}`, "Field 'default' is required"},
+		{"remove field without field", `{"removeField": {"collection": "users"}}`, "Field 'field' is required"},
+		{"set validator without validator", `{"setValidator": {"collection": "users"}}`, "Field 'validator' is required"},
+		{"insert documents without documents", `{"insertDocuments": {"collection": "users"}}`, "Field 'documents' is required"},
+		{"insert documents with empty documents", `{"insertDocuments": {"collection": "users", "documents": []}}`, "Field 'documents' must be non-empty array"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := ExpandChangeTypes([]interface{}{decodeTestCommand(t, c.change)})
+			if err == nil {
+				t.Fatalf("Expected error")
+			}
+			if !strings.Contains(err.Error(), c.message) {
+				t.Errorf("Expected error with '%v', got: %v", c.message, err)
+			}
+		})
+	}
+}
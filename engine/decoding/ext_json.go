@@ -16,11 +16,32 @@ func DecodeExt(data []byte) (interface{}, custom_error.CustomError) {
 	return doc, nil
 }
 
-func DecodeMigration(data []byte) ([]interface{}, custom_error.CustomError) {
+func decodeMigrationDocument(path string, data []byte, source *SourceMap) (bson.D, custom_error.CustomError) {
+	if IsShellSyntax(path) {
+		value, err := DecodeShell(path, data, source)
+		if err != nil {
+			return nil, err
+		}
+		doc, ok := value.(primitive.D)
+		if !ok {
+			return nil, custom_error.MakeErrorf("%v: Migration must be a document, got %T", path, value)
+		}
+		return doc, nil
+	}
 	doc := bson.D{}
 	err := bson.UnmarshalExtJSON(data, false, &doc)
 	if err != nil {
-		return nil, custom_error.MakeErrorf("Failed to decode ext-json. Error: %v", err)
+		return nil, newExtJSONError(path, data, source, err)
+	}
+	return doc, nil
+}
+
+// DecodeMigrationCommands decodes migration file into list of commands and changes, as they are written, without expanding change types.
+// Source maps error positions back to the file, if properties were substituted in data.
+func DecodeMigrationCommands(path string, data []byte, source *SourceMap) ([]interface{}, custom_error.CustomError) {
+	doc, err := decodeMigrationDocument(path, data, source)
+	if err != nil {
+		return nil, err
 	}
 	mapped := doc.Map()
 	if len(mapped) <= 0 {
@@ -41,3 +62,39 @@ func DecodeMigration(data []byte) ([]interface{}, custom_error.CustomError) {
 	}
 	return res, nil
 }
+
+func DecodeMigration(path string, data []byte, source *SourceMap) ([]interface{}, custom_error.CustomError) {
+	commands, err := DecodeMigrationCommands(path, data, source)
+	if err != nil {
+		return nil, err
+	}
+	if commands == nil {
+		return nil, nil
+	}
+	return ExpandChangeTypes(commands)
+}
+
+func getMapCommandName(command map[string]interface{}) (string, custom_error.CustomError) {
+	if len(command) != 1 {
+		return "", custom_error.MakeErrorf("Command name is ambiguous for unordered document with %v keys", len(command))
+	}
+	for k := range command {
+		return k, nil
+	}
+	return "", custom_error.MakeErrorf("Empty command")
+}
+
+func GetCommandName(command interface{}) (string, custom_error.CustomError) {
+	switch typed := command.(type) {
+	case primitive.D:
+		if len(typed) <= 0 {
+			return "", custom_error.MakeErrorf("Empty command")
+		}
+		return typed[0].Key, nil
+	case primitive.M:
+		return getMapCommandName(typed)
+	case map[string]interface{}:
+		return getMapCommandName(typed)
+	}
+	return "", custom_error.MakeErrorf("Unexpected type of command: %T", command)
+}
@@ -0,0 +1,105 @@
+package decoding
+
+import (
+	"github.com/coldze/primitives/custom_error"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type commandInverter func(command primitive.D) ([]interface{}, custom_error.CustomError)
+
+var commandInverters = map[string]commandInverter{
+	"create":           invertCreate,
+	"createIndexes":    invertCreateIndexes,
+	"renameCollection": invertRenameCollection,
+	"insert":           invertInsert,
+}
+
+func invertCreate(command primitive.D) ([]interface{}, custom_error.CustomError) {
+	return []interface{}{primitive.D{{Key: "drop", Value: command[0].Value}}}, nil
+}
+
+func invertCreateIndexes(command primitive.D) ([]interface{}, custom_error.CustomError) {
+	value, ok := lookup(command, "indexes")
+	if !ok {
+		return nil, custom_error.MakeErrorf("Field 'indexes' is required")
+	}
+	indexes, ok := value.(primitive.A)
+	if !ok {
+		return nil, custom_error.MakeErrorf("Field 'indexes' must be an array. Type: %T", value)
+	}
+	res := make([]interface{}, 0, len(indexes))
+	for i := len(indexes) - 1; i >= 0; i-- {
+		index, ok := indexes[i].(primitive.D)
+		if !ok {
+			return nil, custom_error.MakeErrorf("Index at position %v must be a document. Type: %T", i, indexes[i])
+		}
+		name, err := getString(index, "name")
+		if err != nil {
+			return nil, custom_error.NewErrorf(err, "Index at position %v has no name", i)
+		}
+		res = append(res, primitive.D{{Key: "dropIndexes", Value: command[0].Value}, {Key: "index", Value: name}})
+	}
+	return res, nil
+}
+
+func invertRenameCollection(command primitive.D) ([]interface{}, custom_error.CustomError) {
+	to, ok := lookup(command, "to")
+	if !ok {
+		return nil, custom_error.MakeErrorf("Field 'to' is required")
+	}
+	dropTarget, ok := lookup(command, "dropTarget")
+	if ok && dropTarget == true {
+		return nil, custom_error.MakeErrorf("Rename with 'dropTarget' can't be inverted, dropped collection is lost")
+	}
+	return []interface{}{primitive.D{{Key: "renameCollection", Value: to}, {Key: "to", Value: command[0].Value}}}, nil
+}
+
+func invertInsert(command primitive.D) ([]interface{}, custom_error.CustomError) {
+	value, ok := lookup(command, "documents")
+	if !ok {
+		return nil, custom_error.MakeErrorf("Field 'documents' is required")
+	}
+	documents, ok := value.(primitive.A)
+	if !ok {
+		return nil, custom_error.MakeErrorf("Field 'documents' must be an array. Type: %T", value)
+	}
+	ids := primitive.A{}
+	for i := range documents {
+		document, ok := documents[i].(primitive.D)
+		if !ok {
+			return nil, custom_error.MakeErrorf("Document at position %v must be a document. Type: %T", i, documents[i])
+		}
+		id, ok := lookup(document, "_id")
+		if !ok {
+			return nil, custom_error.MakeErrorf("Document at position %v has no '_id', inserted document can't be identified", i)
+		}
+		ids = append(ids, id)
+	}
+	filter := primitive.D{{Key: "_id", Value: primitive.D{{Key: "$in", Value: ids}}}}
+	return []interface{}{primitive.D{
+		{Key: "delete", Value: command[0].Value},
+		{Key: "deletes", Value: primitive.A{primitive.D{{Key: "q", Value: filter}, {Key: "limit", Value: 0}}}},
+	}}, nil
+}
+
+// InvertCommands builds commands, that revert given ones, in reverse order.
+// Fails for commands, which effect can't be reverted deterministically (drop, update, delete, etc.).
+func InvertCommands(commands []interface{}) ([]interface{}, custom_error.CustomError) {
+	res := []interface{}{}
+	for i := len(commands) - 1; i >= 0; i-- {
+		command, ok := commands[i].(primitive.D)
+		if !ok || len(command) <= 0 {
+			return nil, custom_error.MakeErrorf("Can't invert command at position %v. Unexpected type: %T", i, commands[i])
+		}
+		invert, ok := commandInverters[command[0].Key]
+		if !ok {
+			return nil, custom_error.MakeErrorf("Command '%v' at position %v can't be inverted automatically", command[0].Key, i)
+		}
+		inverted, err := invert(command)
+		if err != nil {
+			return nil, custom_error.NewErrorf(err, "Failed to invert command '%v' at position %v", command[0].Key, i)
+		}
+		res = append(res, inverted...)
+	}
+	return res, nil
+}
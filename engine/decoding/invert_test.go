@@ -0,0 +1,99 @@
+package decoding
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestInvertCommands(t *testing.T) {
+	cases := []struct {
+		name     string
+		commands []string
+		expected []interface{}
+	}{
+		{
+			"create",
+			[]string{`{"create": "users", "capped": true}`},
+			[]interface{}{primitive.D{{Key: "drop", Value: "users"}}},
+		},
+		{
+			"create indexes in reverse order",
+			[]string{`{"createIndexes": "users", "indexes": [{"key": {"email": 1}, "name": "email_1"}, {"key": {"name": 1}, "name": "name_1"}]}`},
+			[]interface{}{
+				primitive.D{{Key: "dropIndexes", Value: "users"}, {Key: "index", Value: "name_1"}},
+				primitive.D{{Key: "dropIndexes", Value: "users"}, {Key: "index", Value: "email_1"}},
+			},
+		},
+		{
+			"rename collection",
+			[]string{`{"renameCollection": "db.users", "to": "db.people", "dropTarget": false}`},
+			[]interface{}{primitive.D{{Key: "renameCollection", Value: "db.people"}, {Key: "to", Value: "db.users"}}},
+		},
+		{
+			"insert",
+			[]string{`{"insert": "users", "documents": [{"_id": 1, "name": "first"}, {"_id": "second"}]}`},
+			[]interface{}{primitive.D{
+				{Key: "delete", Value: "users"},
+				{Key: "deletes", Value: primitive.A{primitive.D{
+					{Key: "q", Value: primitive.D{{Key: "_id", Value: primitive.D{{Key: "$in", Value: primitive.A{int32(1), "second"}}}}}},
+					{Key: "limit", Value: 0},
+				}}},
+			}},
+		},
+		{
+			"commands in reverse order",
+			[]string{`{"create": "users"}`, `{"renameCollection": "db.users", "to": "db.people"}`},
+			[]interface{}{
+				primitive.D{{Key: "renameCollection", Value: "db.people"}, {Key: "to", Value: "db.users"}},
+				primitive.D{{Key: "drop", Value: "users"}},
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			commands := []interface{}{}
+			for _, command := range c.commands {
+				commands = append(commands, decodeTestCommand(t, command))
+			}
+			inverted, err := InvertCommands(commands)
+			if err != nil {
+				t.Fatalf("Failed to invert: %v", err)
+			}
+			if !reflect.DeepEqual(inverted, c.expected) {
+				t.Errorf("Unexpected commands.\nExpected: %v\nGot:      %v", c.expected, inverted)
+			}
+		})
+	}
+}
+
+func TestInvertCommandsErrors(t *testing.T) {
+	cases := []struct {
+		name    string
+		command string
+		message string
+	}{
+		{"rename with drop target", `{"renameCollection": "db.users", "to": "db.people", "dropTarget": true}`, "Rename with 'dropTarget' can't be inverted"},
+		{"rename without target", `{"renameCollection": "db.users"}`, "Field 'to' is required"},
+		{"index without name", `{"createIndexes": "users", "indexes": [{"key": {"email": 1}}]}`, "Index at position 0 has no name"},
+		{"indexes of invalid type", `{"createIndexes": "users", "indexes": {"key": {"email": 1}}}`, "Field 'indexes' must be an array"},
+		{"insert without id", `{"insert": "users", "documents": [{"_id": 1}, {"name": "second"}]}`, "Document at position 1 has no '_id'"},
+		{"insert without documents", `{"insert": "users"}`, "Field 'documents' is required"},
+		{"drop", `{"drop": "users"}`, "Command 'drop' at position 0 can't be inverted automatically"},
+		{"update", `{"update": "users", "updates": [{"q": {}, "u": {"$set": {"a": 1}}}]}`, "Command 'update' at position 0 can't be inverted automatically"},
+		{"delete", `{"delete": "users", "deletes": [{"q": {}, "limit": 0}]}`, "Command 'delete' at position 0 can't be inverted automatically"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := InvertCommands([]interface{}{decodeTestCommand(t, c.command)})
+			if err == nil {
+				t.Fatalf("Expected error")
+			}
+			if !strings.Contains(err.Error(), c.message) {
+				t.Errorf("Expected error with '%v', got: %v", c.message, err)
+			}
+		})
+	}
+}
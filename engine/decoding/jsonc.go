@@ -0,0 +1,181 @@
+package decoding
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+func isHorizontalSpace(c byte) bool {
+	return c == SYMBOL_SPACE || c == SYMBOL_TAB || c == SYMBOL_CARRIAGE_RETURN
+}
+
+func isJSONSpace(c byte) bool {
+	return isHorizontalSpace(c) || c == SYMBOL_NEW_LINE
+}
+
+// commentEnd returns offset right after the comment, that starts at pos, or -1 if there's no comment at pos.
+// Unterminated block comments are not treated as comments, so JSON decoder reports them.
+func commentEnd(data []byte, pos int) int {
+	if pos+1 >= len(data) || data[pos] != SYMBOL_SLASH {
+		return -1
+	}
+	switch data[pos+1] {
+	case SYMBOL_SLASH:
+		end := bytes.IndexByte(data[pos:], SYMBOL_NEW_LINE)
+		if end < 0 {
+			return len(data)
+		}
+		if data[pos+end-1] == SYMBOL_CARRIAGE_RETURN {
+			end--
+		}
+		return pos + end
+	case SYMBOL_ASTERISK:
+		end := bytes.Index(data[pos+2:], []byte("*/"))
+		if end < 0 {
+			return -1
+		}
+		return pos + 2 + end + 2
+	}
+	return -1
+}
+
+func skipSpaceAndComments(data []byte, pos int) int {
+	for pos < len(data) {
+		if isJSONSpace(data[pos]) {
+			pos++
+			continue
+		}
+		end := commentEnd(data, pos)
+		if end < 0 {
+			return pos
+		}
+		pos = end
+	}
+	return pos
+}
+
+func isTrailingComma(data []byte, pos int) bool {
+	next := skipSpaceAndComments(data, pos+1)
+	return next < len(data) && (data[next] == SYMBOL_CURL_BRACER_CLOSE || data[next] == SYMBOL_BRACER_CLOSE)
+}
+
+type jsoncWriter interface {
+	comment(data []byte, start int, end int) int
+	trailingComma()
+	write(c byte)
+}
+
+func transformJSONC(data []byte, writer jsoncWriter) {
+	inString := false
+	for i := 0; i < len(data); {
+		c := data[i]
+		if inString {
+			writer.write(c)
+			if c == SYMBOL_BACKSLASH && i+1 < len(data) {
+				writer.write(data[i+1])
+				i += 2
+				continue
+			}
+			inString = c != SYMBOL_QUOTE
+			i++
+			continue
+		}
+		if c == SYMBOL_QUOTE {
+			inString = true
+			writer.write(c)
+			i++
+			continue
+		}
+		if c == SYMBOL_COMMA && isTrailingComma(data, i) {
+			writer.trailingComma()
+			i++
+			continue
+		}
+		end := commentEnd(data, i)
+		if end < 0 {
+			writer.write(c)
+			i++
+			continue
+		}
+		i = writer.comment(data, i, end)
+	}
+}
+
+// layoutWriter blanks comments and trailing commas with spaces, so offsets, lines and columns of decoding errors
+// still point into the original file.
+type layoutWriter struct {
+	out bytes.Buffer
+}
+
+func (w *layoutWriter) comment(data []byte, start int, end int) int {
+	for i := start; i < end; {
+		r, size := utf8.DecodeRune(data[i:end])
+		if r == SYMBOL_NEW_LINE || r == SYMBOL_CARRIAGE_RETURN {
+			w.out.WriteRune(r)
+		} else {
+			w.out.WriteByte(SYMBOL_SPACE)
+		}
+		i += size
+	}
+	return end
+}
+
+func (w *layoutWriter) trailingComma() {
+	w.out.WriteByte(SYMBOL_SPACE)
+}
+
+func (w *layoutWriter) write(c byte) {
+	w.out.WriteByte(c)
+}
+
+// removingWriter drops comments together with whitespace they leave behind and trailing commas, so annotating a file
+// produces exactly the same bytes, as the file had before annotation.
+type removingWriter struct {
+	out []byte
+}
+
+func (w *removingWriter) comment(data []byte, start int, end int) int {
+	next := end
+	for next < len(data) && isHorizontalSpace(data[next]) {
+		next++
+	}
+	if next < len(data) && data[next] != SYMBOL_NEW_LINE {
+		return next
+	}
+	length := len(w.out)
+	for length > 0 && isHorizontalSpace(w.out[length-1]) {
+		length--
+	}
+	w.out = w.out[:length]
+	if length > 0 && w.out[length-1] != SYMBOL_NEW_LINE {
+		return end
+	}
+	if next < len(data) {
+		next++
+	}
+	return next
+}
+
+func (w *removingWriter) trailingComma() {
+}
+
+func (w *removingWriter) write(c byte) {
+	w.out = append(w.out, c)
+}
+
+// StripJSONC converts JSON with comments (`//`, `/* */`) and trailing commas into plain JSON of the same layout.
+func StripJSONC(data []byte) []byte {
+	writer := &layoutWriter{}
+	transformJSONC(data, writer)
+	return writer.out.Bytes()
+}
+
+// CanonicalJSONC removes comments and trailing commas. Content without them is returned unchanged.
+func CanonicalJSONC(path string, data []byte) []byte {
+	if IsYAML(path) || IsShellSyntax(path) {
+		return data
+	}
+	writer := &removingWriter{out: make([]byte, 0, len(data))}
+	transformJSONC(data, writer)
+	return writer.out
+}
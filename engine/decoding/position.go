@@ -0,0 +1,205 @@
+package decoding
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/coldze/primitives/custom_error"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	snippetMaxLength = 120
+)
+
+// locate converts byte offset into 1-based line and column (in runes) and returns text of the line.
+func locate(data []byte, offset int64) (int, int, string) {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	lineStart := bytes.LastIndexByte(data[:offset], '\n') + 1
+	lineEnd := bytes.IndexByte(data[lineStart:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(data)
+	} else {
+		lineEnd += lineStart
+	}
+	line := bytes.Count(data[:offset], []byte{'\n'}) + 1
+	column := utf8.RuneCount(data[lineStart:offset]) + 1
+	return line, column, strings.TrimRight(string(data[lineStart:lineEnd]), "\r")
+}
+
+func snippet(text string, column int) string {
+	runes := []rune(text)
+	start := 0
+	if column > snippetMaxLength {
+		start = column - snippetMaxLength/2
+	}
+	end := len(runes)
+	if end-start > snippetMaxLength {
+		end = start + snippetMaxLength
+	}
+	prefix := strings.Map(func(r rune) rune {
+		if r == '\t' {
+			return r
+		}
+		return ' '
+	}, string(runes[start:column-1]))
+	return fmt.Sprintf("    %v\n    %v^", string(runes[start:end]), prefix)
+}
+
+// Substitution tells, that Length bytes at Offset of substituted text replaced RawLength bytes at RawOffset of the file.
+type Substitution struct {
+	Offset    int64
+	Length    int64
+	RawOffset int64
+	RawLength int64
+}
+
+// SourceMap maps offsets in text after property substitution back to the file, so errors point to what user wrote.
+type SourceMap struct {
+	raw           []byte
+	substitutions []Substitution
+}
+
+func NewSourceMap(raw []byte, substitutions []Substitution) *SourceMap {
+	return &SourceMap{
+		raw:           raw,
+		substitutions: substitutions,
+	}
+}
+
+func (m *SourceMap) original(offset int64) int64 {
+	delta := int64(0)
+	for _, s := range m.substitutions {
+		if offset < s.Offset {
+			break
+		}
+		if offset < s.Offset+s.Length {
+			return s.RawOffset
+		}
+		delta = s.RawOffset + s.RawLength - s.Offset - s.Length
+	}
+	return offset + delta
+}
+
+// position returns file content and offset in it for offset in data. Nil map means data is the file content.
+func (m *SourceMap) position(data []byte, offset int64) ([]byte, int64) {
+	if m == nil {
+		return data, offset
+	}
+	return m.raw, m.original(offset)
+}
+
+// NewPositionErrorf reports error as path:line:column with a snippet of the offending line, so editors and CI can jump to it.
+func NewPositionErrorf(path string, data []byte, offset int64, format string, args ...interface{}) custom_error.CustomError {
+	line, column, text := locate(data, offset)
+	return custom_error.MakeErrorf("%v:%v:%v: %v\n%v", path, line, column, fmt.Sprintf(format, args...), snippet(text, column))
+}
+
+// valueStart moves offset from the end of scalar value, reported by encoding/json for type errors, to its beginning.
+func valueStart(data []byte, end int64) int64 {
+	if end <= 0 || end > int64(len(data)) {
+		return end - 1
+	}
+	i := end - 1
+	if data[i] == '"' {
+		for i--; i >= 0; i-- {
+			if data[i] == '"' && (i == 0 || data[i-1] != '\\') {
+				return i
+			}
+		}
+		return end - 1
+	}
+	for i > 0 && !strings.ContainsRune(":,[{ \t\r\n", rune(data[i-1])) {
+		i--
+	}
+	return i
+}
+
+// NewJSONError adds position to errors of encoding/json. Positions are not reported for YAML files,
+// since offsets point into JSON, converted from YAML, not into the file itself.
+func NewJSONError(path string, data []byte, source *SourceMap, err error) custom_error.CustomError {
+	if !IsYAML(path) {
+		switch typed := err.(type) {
+		case *json.SyntaxError:
+			raw, offset := source.position(data, typed.Offset-1)
+			return NewPositionErrorf(path, raw, offset, "%v", err)
+		case *json.UnmarshalTypeError:
+			raw, offset := source.position(data, valueStart(data, typed.Offset))
+			return NewPositionErrorf(path, raw, offset, "%v", err)
+		}
+	}
+	return custom_error.MakeErrorf("%v: %v", path, err)
+}
+
+// locateExtJSONError finds innermost Extended JSON wrapper ({"$date": ...}, {"$oid": ...}, etc.), which driver fails to decode.
+func locateExtJSONError(data []byte) (int64, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	type object struct {
+		start   int64
+		isFirst bool
+		wrapper bool
+	}
+	objects := []*object{}
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return 0, nil
+		}
+		switch typed := token.(type) {
+		case json.Delim:
+			if typed == '{' {
+				objects = append(objects, &object{start: decoder.InputOffset() - 1, isFirst: true})
+				continue
+			}
+			if typed != '}' {
+				continue
+			}
+			current := objects[len(objects)-1]
+			objects = objects[:len(objects)-1]
+			if !current.wrapper {
+				continue
+			}
+			wrapped := append(append([]byte("{\"v\":"), data[current.start:decoder.InputOffset()]...), '}')
+			doc := bson.D{}
+			err := bson.UnmarshalExtJSON(wrapped, false, &doc)
+			if err != nil {
+				return current.start, err
+			}
+		case string:
+			if len(objects) <= 0 {
+				continue
+			}
+			current := objects[len(objects)-1]
+			if current.isFirst {
+				current.wrapper = strings.HasPrefix(typed, "$")
+			}
+			current.isFirst = false
+		}
+	}
+}
+
+func newExtJSONError(path string, data []byte, source *SourceMap, err error) custom_error.CustomError {
+	if IsYAML(path) {
+		return custom_error.MakeErrorf("%v: Failed to decode ext-json. Error: %v", path, err)
+	}
+	syntaxCheck := json.NewDecoder(bytes.NewReader(data))
+	var value interface{}
+	jsonErr := syntaxCheck.Decode(&value)
+	if jsonErr != nil {
+		return NewJSONError(path, data, source, jsonErr)
+	}
+	offset, wrapperErr := locateExtJSONError(data)
+	if wrapperErr != nil {
+		raw, offset := source.position(data, offset)
+		return NewPositionErrorf(path, raw, offset, "Failed to decode ext-json. Error: %v", wrapperErr)
+	}
+	return custom_error.MakeErrorf("%v: Failed to decode ext-json. Error: %v", path, err)
+}
@@ -0,0 +1,154 @@
+package decoding
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/coldze/primitives/custom_error"
+	"gopkg.in/yaml.v3"
+)
+
+func IsYAML(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+func writeJSONString(out *bytes.Buffer, value string) custom_error.CustomError {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return custom_error.MakeErrorf("Failed to encode string. Error: %v", err)
+	}
+	out.Write(encoded)
+	return nil
+}
+
+func writeJSONFloat(out *bytes.Buffer, value float64) custom_error.CustomError {
+	if math.IsInf(value, 0) || math.IsNaN(value) {
+		return custom_error.MakeErrorf("Unsupported float value: %v. Use {\"$numberDouble\": \"...\"} instead", value)
+	}
+	formatted := strconv.FormatFloat(value, 'g', -1, 64)
+	if !strings.ContainsAny(formatted, ".eE") {
+		formatted += ".0"
+	}
+	out.WriteString(formatted)
+	return nil
+}
+
+func writeJSONScalar(out *bytes.Buffer, node *yaml.Node) custom_error.CustomError {
+	switch node.ShortTag() {
+	case "!!null":
+		out.WriteString("null")
+	case "!!bool":
+		value := false
+		err := node.Decode(&value)
+		if err != nil {
+			return custom_error.MakeErrorf("Failed to decode bool. Error: %v", err)
+		}
+		out.WriteString(strconv.FormatBool(value))
+	case "!!int":
+		value := int64(0)
+		err := node.Decode(&value)
+		if err != nil {
+			return custom_error.MakeErrorf("Failed to decode int. Error: %v", err)
+		}
+		out.WriteString(strconv.FormatInt(value, 10))
+	case "!!float":
+		value := float64(0)
+		err := node.Decode(&value)
+		if err != nil {
+			return custom_error.MakeErrorf("Failed to decode float. Error: %v", err)
+		}
+		return writeJSONFloat(out, value)
+	default:
+		return writeJSONString(out, node.Value)
+	}
+	return nil
+}
+
+func writeJSON(out *bytes.Buffer, node *yaml.Node) custom_error.CustomError {
+	switch node.Kind {
+	case 0:
+		out.WriteString("{}")
+	case yaml.DocumentNode:
+		if len(node.Content) <= 0 {
+			out.WriteString("{}")
+			return nil
+		}
+		return writeJSON(out, node.Content[0])
+	case yaml.AliasNode:
+		return writeJSON(out, node.Alias)
+	case yaml.ScalarNode:
+		err := writeJSONScalar(out, node)
+		if err != nil {
+			return custom_error.NewErrorf(err, "Invalid value at line %v, column %v", node.Line, node.Column)
+		}
+	case yaml.SequenceNode:
+		out.WriteByte('[')
+		for i := range node.Content {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			err := writeJSON(out, node.Content[i])
+			if err != nil {
+				return custom_error.NewErrorf(err, "Failed to encode array item #%v", i)
+			}
+		}
+		out.WriteByte(']')
+	case yaml.MappingNode:
+		out.WriteByte('{')
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			if key.Kind != yaml.ScalarNode || key.ShortTag() == "!!merge" {
+				return custom_error.MakeErrorf("Unsupported key at line %v, column %v. Only scalar keys are supported", key.Line, key.Column)
+			}
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			err := writeJSONString(out, key.Value)
+			if err != nil {
+				return custom_error.NewErrorf(err, "Failed to encode key")
+			}
+			out.WriteByte(':')
+			err = writeJSON(out, node.Content[i+1])
+			if err != nil {
+				return custom_error.NewErrorf(err, "Failed to encode value of key '%v'", key.Value)
+			}
+		}
+		out.WriteByte('}')
+	default:
+		return custom_error.MakeErrorf("Unsupported YAML node at line %v, column %v", node.Line, node.Column)
+	}
+	return nil
+}
+
+func YAMLToJSON(data []byte) ([]byte, custom_error.CustomError) {
+	doc := yaml.Node{}
+	err := yaml.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, custom_error.MakeErrorf("Failed to decode yaml. Error: %v", err)
+	}
+	out := &bytes.Buffer{}
+	errValue := writeJSON(out, &doc)
+	if errValue != nil {
+		return nil, custom_error.NewErrorf(errValue, "Failed to convert yaml into json")
+	}
+	return out.Bytes(), nil
+}
+
+func ToJSON(path string, data []byte) ([]byte, custom_error.CustomError) {
+	if IsShellSyntax(path) {
+		return data, nil
+	}
+	if !IsYAML(path) {
+		return StripJSONC(data), nil
+	}
+	converted, err := YAMLToJSON(data)
+	if err != nil {
+		return nil, custom_error.NewErrorf(err, "Failed to convert '%v' into json", path)
+	}
+	return converted, nil
+}
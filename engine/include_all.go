@@ -0,0 +1,121 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/coldze/primitives/custom_error"
+)
+
+const (
+	defaultIncludeAllPattern = "changelog.json"
+)
+
+var includeAllFields = map[string]struct{}{
+	"includeAll":              {},
+	"relativeToChangelogFile": {},
+	"recursive":               {},
+	"pattern":                 {},
+}
+
+func getBoolField(mapVal map[string]interface{}, name string, defaultValue bool) (bool, custom_error.CustomError) {
+	value, ok := mapVal[name]
+	if !ok {
+		return defaultValue, nil
+	}
+	boolValue, ok := value.(bool)
+	if !ok {
+		return false, custom_error.MakeErrorf("Invalid format for `%v`. Type: %T", name, value)
+	}
+	return boolValue, nil
+}
+
+func getStringField(mapVal map[string]interface{}, name string, defaultValue string) (string, custom_error.CustomError) {
+	value, ok := mapVal[name]
+	if !ok {
+		return defaultValue, nil
+	}
+	strValue, ok := value.(string)
+	if !ok {
+		return "", custom_error.MakeErrorf("Invalid format for `%v`. Type: %T", name, value)
+	}
+	return strValue, nil
+}
+
+func collectIncludeAllFromMap(mapVal map[string]interface{}) ([]*MigrationFile, custom_error.CustomError) {
+	for k := range mapVal {
+		_, ok := includeAllFields[k]
+		if !ok {
+			return nil, custom_error.MakeErrorf("Extra field `%v` specified for `includeAll`. %+v", k, mapVal)
+		}
+	}
+	dir, err := getStringField(mapVal, "includeAll", "")
+	if err != nil {
+		return nil, err
+	}
+	relative, err := getBoolField(mapVal, "relativeToChangelogFile", true)
+	if err != nil {
+		return nil, err
+	}
+	recursive, err := getBoolField(mapVal, "recursive", false)
+	if err != nil {
+		return nil, err
+	}
+	pattern, err := getStringField(mapVal, "pattern", defaultIncludeAllPattern)
+	if err != nil {
+		return nil, err
+	}
+	return []*MigrationFile{
+		&MigrationFile{
+			IncludeAll:   dir,
+			RelativePath: relative,
+			Recursive:    recursive,
+			Pattern:      pattern,
+		},
+	}, nil
+}
+
+func matchIncludeAll(m *MigrationFile, name string) (bool, custom_error.CustomError) {
+	matched, err := filepath.Match(m.Pattern, name)
+	if err != nil {
+		return false, custom_error.MakeErrorf("Invalid pattern '%v'. Error: %v", m.Pattern, err)
+	}
+	return matched, nil
+}
+
+func expandIncludeAll(m *MigrationFile, workingDir string, changelogPath string) ([]string, custom_error.CustomError) {
+	root := getFullPath(m.RelativePath, workingDir, changelogPath, m.IncludeAll)
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, custom_error.MakeErrorf("Failed to read directory '%v'. Error: %v", m.IncludeAll, err)
+	}
+	if !info.IsDir() {
+		return nil, custom_error.MakeErrorf("'%v' is not a directory", m.IncludeAll)
+	}
+	paths := []string{}
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != root && !m.Recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		matched, errValue := matchIncludeAll(m, info.Name())
+		if errValue != nil {
+			return errValue
+		}
+		if matched {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, custom_error.MakeErrorf("Failed to scan directory '%v'. Error: %v", m.IncludeAll, err)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
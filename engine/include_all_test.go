@@ -0,0 +1,103 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExpandIncludeAll(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"migrations/20190102_00001/changelog.json":        "{}",
+		"migrations/20190101_00002/changelog.json":        "{}",
+		"migrations/20190101_00001/changelog.json":        "{}",
+		"migrations/20190101_00001/00001_users.json":      "{}",
+		"migrations/20190101_00001/nested/changelog.json": "{}",
+		"migrations/changelog.json":                       "{}",
+		"migrations/20190103.json":                        "{}",
+		"migrations/README.md":                            "",
+	})
+	defer os.RemoveAll(dir)
+	cases := []struct {
+		name      string
+		pattern   string
+		recursive bool
+		expected  []string
+	}{
+		{"top level", defaultIncludeAllPattern, false, []string{"changelog.json"}},
+		{"recursive in lexical order", defaultIncludeAllPattern, true, []string{
+			"20190101_00001/changelog.json",
+			"20190101_00001/nested/changelog.json",
+			"20190101_00002/changelog.json",
+			"20190102_00001/changelog.json",
+			"changelog.json",
+		}},
+		{"pattern", "2019*.json", false, []string{"20190103.json"}},
+		{"recursive pattern", "0000?_*.json", true, []string{"20190101_00001/00001_users.json"}},
+	}
+	for _, c := range cases {
+		m := &MigrationFile{IncludeAll: "migrations", RelativePath: true, Recursive: c.recursive, Pattern: c.pattern}
+		paths, err := expandIncludeAll(m, dir, dir)
+		if err != nil {
+			t.Errorf("%v: failed to expand: %v", c.name, err)
+			continue
+		}
+		relative := []string{}
+		for _, path := range paths {
+			rel, _ := filepath.Rel(filepath.Join(dir, "migrations"), path)
+			relative = append(relative, filepath.ToSlash(rel))
+		}
+		if !reflect.DeepEqual(relative, c.expected) {
+			t.Errorf("%v: expected %v, got %v", c.name, c.expected, relative)
+		}
+	}
+}
+
+func TestExpandIncludeAllErrors(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"migrations/changelog.json": "{}",
+	})
+	defer os.RemoveAll(dir)
+	cases := []struct {
+		name     string
+		include  string
+		pattern  string
+		expected string
+	}{
+		{"missing directory", "missing", defaultIncludeAllPattern, "Failed to read directory 'missing'"},
+		{"file instead of directory", "migrations/changelog.json", defaultIncludeAllPattern, "is not a directory"},
+		{"invalid pattern", "migrations", "[", "Invalid pattern '['"},
+	}
+	for _, c := range cases {
+		m := &MigrationFile{IncludeAll: c.include, RelativePath: true, Pattern: c.pattern}
+		_, err := expandIncludeAll(m, dir, dir)
+		if err == nil || !strings.Contains(err.Error(), c.expected) {
+			t.Errorf("%v: expected error with '%v', got: %v", c.name, c.expected, err)
+		}
+	}
+}
+
+func TestIncludeAllSkipsMainChangeLog(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"changelog.json":          `{"connection": "mongodb://localhost:27017", "dbname": "mongol", "migrations": [{"includeAll": ".", "recursive": true}]}`,
+		"b/changelog.json":        `{"id": "b", "changes": [{"migration": "../insert.json", "rollback": []}]}`,
+		"a/changelog.json":        `{"id": "a", "changes": [{"migration": "../insert.json", "rollback": []}]}`,
+		"a/nested/changelog.json": `{"id": "a_nested", "changes": [{"migration": "../../insert.json", "rollback": []}]}`,
+		"insert.json":             `{"insert": "users", "documents": [{"_id": 1}]}`,
+	})
+	defer os.RemoveAll(dir)
+	changeLog, err := NewChangeLog(filepath.Join(dir, "changelog.json"), Properties{})
+	if err != nil {
+		t.Fatalf("Failed to load changelog: %v", err)
+	}
+	ids := []string{}
+	for _, changeSet := range changeLog.GetChangeSets() {
+		ids = append(ids, changeSet.ID)
+	}
+	expected := []string{"a", "a_nested", "b"}
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("Expected change sets %v, got %v", expected, ids)
+	}
+}
@@ -0,0 +1,336 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coldze/mongol/engine/decoding"
+	"github.com/coldze/primitives/custom_error"
+	"github.com/dop251/goja"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type jsLong struct {
+	value int64
+}
+
+type jsInt struct {
+	value int32
+}
+
+func IsJavaScript(path string) bool {
+	return strings.ToLower(filepath.Ext(path)) == ".js"
+}
+
+// JSMigration runs mongo-shell style script. Write operations of the script are turned into
+// server commands and sent into visitor, so scripts run on servers without eval and in dry-run mode.
+type JSMigration struct {
+	source  *MigrationFile
+	program *goja.Program
+}
+
+func NewJSMigration(m *MigrationFile, path string, content []byte) (*JSMigration, custom_error.CustomError) {
+	program, err := goja.Compile(path, string(content), false)
+	if err != nil {
+		return nil, custom_error.MakeErrorf("Failed to compile script '%v'. Error: %v", path, err)
+	}
+	return &JSMigration{
+		source:  m,
+		program: program,
+	}, nil
+}
+
+func (j *JSMigration) Apply(visitor DocumentApplier) custom_error.CustomError {
+	vm := goja.New()
+	shell := &jsShell{
+		vm:      vm,
+		visitor: visitor,
+	}
+	err := shell.setup()
+	if err != nil {
+		return custom_error.NewErrorf(err, "Failed to prepare script runtime")
+	}
+	_, runErr := vm.RunProgram(j.program)
+	if runErr != nil {
+		return custom_error.MakeErrorf("Script failed. Error: %v", runErr)
+	}
+	return nil
+}
+
+type jsShell struct {
+	vm      *goja.Runtime
+	visitor DocumentApplier
+}
+
+func (s *jsShell) throw(err error) {
+	panic(s.vm.NewGoError(err))
+}
+
+func (s *jsShell) toBSON(value goja.Value) interface{} {
+	if value == nil || goja.IsUndefined(value) || goja.IsNull(value) {
+		return nil
+	}
+	obj, ok := value.(*goja.Object)
+	if !ok {
+		exported := value.Export()
+		number, ok := exported.(int64)
+		if !ok {
+			return exported
+		}
+		if number >= math.MinInt32 && number <= math.MaxInt32 {
+			return int32(number)
+		}
+		return number
+	}
+	switch exported := obj.Export().(type) {
+	case primitive.ObjectID, primitive.Decimal128, time.Time:
+		return exported
+	case jsLong:
+		return exported.value
+	case jsInt:
+		return exported.value
+	}
+	switch obj.ClassName() {
+	case "Array":
+		length := int(obj.Get("length").ToInteger())
+		arr := make(primitive.A, 0, length)
+		for i := 0; i < length; i++ {
+			arr = append(arr, s.toBSON(obj.Get(strconv.Itoa(i))))
+		}
+		return arr
+	case "Function":
+		s.throw(fmt.Errorf("functions can't be stored in documents"))
+	}
+	doc := primitive.D{}
+	for _, key := range obj.Keys() {
+		doc = append(doc, primitive.E{Key: key, Value: s.toBSON(obj.Get(key))})
+	}
+	return doc
+}
+
+func (s *jsShell) toDocument(value goja.Value, name string) primitive.D {
+	if value == nil || goja.IsUndefined(value) || goja.IsNull(value) {
+		return primitive.D{}
+	}
+	doc, ok := s.toBSON(value).(primitive.D)
+	if !ok {
+		s.throw(fmt.Errorf("%v must be a document", name))
+	}
+	return doc
+}
+
+func (s *jsShell) getBool(options primitive.D, key string) bool {
+	for i := range options {
+		if options[i].Key == key {
+			value, ok := options[i].Value.(bool)
+			return ok && value
+		}
+	}
+	return false
+}
+
+func (s *jsShell) run(commands ...interface{}) goja.Value {
+	for _, command := range commands {
+		err := s.visitor.Apply(command)
+		if err != nil {
+			s.throw(err)
+		}
+	}
+	return goja.Undefined()
+}
+
+func (s *jsShell) runChange(changeType string, params primitive.D) goja.Value {
+	commands, err := decoding.ExpandChangeTypes([]interface{}{primitive.D{{Key: changeType, Value: params}}})
+	if err != nil {
+		s.throw(err)
+	}
+	return s.run(commands...)
+}
+
+func (s *jsShell) update(collection string, call goja.FunctionCall, multi bool) goja.Value {
+	options := s.toDocument(call.Argument(2), "options")
+	update := primitive.D{
+		{Key: "q", Value: s.toDocument(call.Argument(0), "filter")},
+		{Key: "u", Value: s.toBSON(call.Argument(1))},
+		{Key: "upsert", Value: s.getBool(options, "upsert")},
+		{Key: "multi", Value: multi},
+	}
+	return s.run(primitive.D{{Key: "update", Value: collection}, {Key: "updates", Value: primitive.A{update}}})
+}
+
+func (s *jsShell) delete(collection string, call goja.FunctionCall, limit int32) goja.Value {
+	deletion := primitive.D{
+		{Key: "q", Value: s.toDocument(call.Argument(0), "filter")},
+		{Key: "limit", Value: limit},
+	}
+	return s.run(primitive.D{{Key: "delete", Value: collection}, {Key: "deletes", Value: primitive.A{deletion}}})
+}
+
+func (s *jsShell) newCollection(name string) goja.Value {
+	collection := s.vm.NewObject()
+	methods := map[string]func(call goja.FunctionCall) goja.Value{
+		"insertOne": func(call goja.FunctionCall) goja.Value {
+			document := s.toDocument(call.Argument(0), "document")
+			return s.run(primitive.D{{Key: "insert", Value: name}, {Key: "documents", Value: primitive.A{document}}})
+		},
+		"insertMany": func(call goja.FunctionCall) goja.Value {
+			documents, ok := s.toBSON(call.Argument(0)).(primitive.A)
+			if !ok {
+				s.throw(fmt.Errorf("documents must be an array"))
+			}
+			return s.run(primitive.D{{Key: "insert", Value: name}, {Key: "documents", Value: documents}})
+		},
+		"updateOne": func(call goja.FunctionCall) goja.Value {
+			return s.update(name, call, false)
+		},
+		"updateMany": func(call goja.FunctionCall) goja.Value {
+			return s.update(name, call, true)
+		},
+		"replaceOne": func(call goja.FunctionCall) goja.Value {
+			return s.update(name, call, false)
+		},
+		"deleteOne": func(call goja.FunctionCall) goja.Value {
+			return s.delete(name, call, 1)
+		},
+		"deleteMany": func(call goja.FunctionCall) goja.Value {
+			return s.delete(name, call, 0)
+		},
+		"createIndex": func(call goja.FunctionCall) goja.Value {
+			params := primitive.D{{Key: "collection", Value: name}, {Key: "keys", Value: s.toDocument(call.Argument(0), "keys")}}
+			params = append(params, s.toDocument(call.Argument(1), "options")...)
+			return s.runChange("createIndex", params)
+		},
+		"dropIndex": func(call goja.FunctionCall) goja.Value {
+			return s.run(primitive.D{{Key: "dropIndexes", Value: name}, {Key: "index", Value: s.toBSON(call.Argument(0))}})
+		},
+		"drop": func(call goja.FunctionCall) goja.Value {
+			return s.run(primitive.D{{Key: "drop", Value: name}})
+		},
+		"renameCollection": func(call goja.FunctionCall) goja.Value {
+			command := primitive.D{{Key: "renameCollection", Value: name}, {Key: "to", Value: call.Argument(0).String()}}
+			if call.Argument(1).ToBoolean() {
+				command = append(command, primitive.E{Key: "dropTarget", Value: true})
+			}
+			return s.run(command)
+		},
+	}
+	for method, impl := range methods {
+		collection.Set(method, impl)
+	}
+	return collection
+}
+
+type jsDatabase struct {
+	shell   *jsShell
+	methods map[string]goja.Value
+}
+
+func (d *jsDatabase) Get(key string) goja.Value {
+	method, ok := d.methods[key]
+	if ok {
+		return method
+	}
+	return d.shell.newCollection(key)
+}
+
+func (d *jsDatabase) Set(key string, val goja.Value) bool {
+	return false
+}
+
+func (d *jsDatabase) Has(key string) bool {
+	return true
+}
+
+func (d *jsDatabase) Delete(key string) bool {
+	return false
+}
+
+func (d *jsDatabase) Keys() []string {
+	return []string{}
+}
+
+func (s *jsShell) newDatabase() *goja.Object {
+	db := &jsDatabase{
+		shell: s,
+		methods: map[string]goja.Value{
+			"getCollection": s.vm.ToValue(func(call goja.FunctionCall) goja.Value {
+				return s.newCollection(call.Argument(0).String())
+			}),
+			"createCollection": s.vm.ToValue(func(call goja.FunctionCall) goja.Value {
+				command := append(primitive.D{{Key: "create", Value: call.Argument(0).String()}}, s.toDocument(call.Argument(1), "options")...)
+				return s.run(command)
+			}),
+			"runCommand": s.vm.ToValue(func(call goja.FunctionCall) goja.Value {
+				return s.run(s.toDocument(call.Argument(0), "command"))
+			}),
+		},
+	}
+	return s.vm.NewDynamicObject(db)
+}
+
+func (s *jsShell) setup() custom_error.CustomError {
+	helpers := map[string]interface{}{
+		"db": s.newDatabase(),
+		"ObjectId": func(call goja.FunctionCall) goja.Value {
+			if goja.IsUndefined(call.Argument(0)) {
+				return s.vm.ToValue(primitive.NewObjectID())
+			}
+			id, err := primitive.ObjectIDFromHex(call.Argument(0).String())
+			if err != nil {
+				s.throw(err)
+			}
+			return s.vm.ToValue(id)
+		},
+		"ISODate": func(call goja.FunctionCall) goja.Value {
+			if goja.IsUndefined(call.Argument(0)) {
+				return s.vm.ToValue(time.Now().UTC())
+			}
+			date, err := decoding.ParseDate(call.Argument(0).String())
+			if err != nil {
+				s.throw(err)
+			}
+			return s.vm.ToValue(date)
+		},
+		"NumberLong": func(call goja.FunctionCall) goja.Value {
+			value, err := strconv.ParseInt(call.Argument(0).String(), 10, 64)
+			if err != nil {
+				s.throw(err)
+			}
+			return s.vm.ToValue(jsLong{value: value})
+		},
+		"NumberInt": func(call goja.FunctionCall) goja.Value {
+			value, err := strconv.ParseInt(call.Argument(0).String(), 10, 32)
+			if err != nil {
+				s.throw(err)
+			}
+			return s.vm.ToValue(jsInt{value: int32(value)})
+		},
+		"NumberDecimal": func(call goja.FunctionCall) goja.Value {
+			value, err := primitive.ParseDecimal128(call.Argument(0).String())
+			if err != nil {
+				s.throw(err)
+			}
+			return s.vm.ToValue(value)
+		},
+		"print": func(call goja.FunctionCall) goja.Value {
+			args := make([]interface{}, 0, len(call.Arguments))
+			for _, arg := range call.Arguments {
+				args = append(args, arg.String())
+			}
+			fmt.Fprintln(os.Stderr, args...)
+			return goja.Undefined()
+		},
+	}
+	for name, value := range helpers {
+		err := s.vm.Set(name, value)
+		if err != nil {
+			return custom_error.MakeErrorf("Failed to define '%v'. Error: %v", name, err)
+		}
+	}
+	return nil
+}
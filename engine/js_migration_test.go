@@ -0,0 +1,164 @@
+package engine
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func runTestScript(script string, applier DocumentApplier) error {
+	migration, err := NewJSMigration(nil, "test.js", []byte(script))
+	if err != nil {
+		return err
+	}
+	errValue := migration.Apply(applier)
+	if errValue != nil {
+		return errValue
+	}
+	return nil
+}
+
+func TestJSMigrationCommands(t *testing.T) {
+	cases := []struct {
+		name     string
+		script   string
+		expected []interface{}
+	}{
+		{
+			name:   "insertOne",
+			script: `db.users.insertOne({_id: 1, visits: 3000000000, ratio: 0.5, name: "first", tags: ["a"]});`,
+			expected: []interface{}{primitive.D{{Key: "insert", Value: "users"}, {Key: "documents", Value: primitive.A{primitive.D{
+				{Key: "_id", Value: int32(1)}, {Key: "visits", Value: int64(3000000000)}, {Key: "ratio", Value: 0.5},
+				{Key: "name", Value: "first"}, {Key: "tags", Value: primitive.A{"a"}},
+			}}}}},
+		},
+		{
+			name:   "insertMany",
+			script: `db.getCollection("users").insertMany([{_id: 1}, {_id: 2}]);`,
+			expected: []interface{}{primitive.D{{Key: "insert", Value: "users"}, {Key: "documents", Value: primitive.A{
+				primitive.D{{Key: "_id", Value: int32(1)}}, primitive.D{{Key: "_id", Value: int32(2)}},
+			}}}},
+		},
+		{
+			name:   "updateOne",
+			script: `db.users.updateOne({_id: 1}, {$set: {name: "first"}}, {upsert: true});`,
+			expected: []interface{}{primitive.D{{Key: "update", Value: "users"}, {Key: "updates", Value: primitive.A{primitive.D{
+				{Key: "q", Value: primitive.D{{Key: "_id", Value: int32(1)}}},
+				{Key: "u", Value: primitive.D{{Key: "$set", Value: primitive.D{{Key: "name", Value: "first"}}}}},
+				{Key: "upsert", Value: true},
+				{Key: "multi", Value: false},
+			}}}}},
+		},
+		{
+			name:   "updateMany",
+			script: `db.users.updateMany({}, {$unset: {name: ""}});`,
+			expected: []interface{}{primitive.D{{Key: "update", Value: "users"}, {Key: "updates", Value: primitive.A{primitive.D{
+				{Key: "q", Value: primitive.D{}},
+				{Key: "u", Value: primitive.D{{Key: "$unset", Value: primitive.D{{Key: "name", Value: ""}}}}},
+				{Key: "upsert", Value: false},
+				{Key: "multi", Value: true},
+			}}}}},
+		},
+		{
+			name:   "deleteOne and deleteMany",
+			script: `db.users.deleteOne({_id: 1}); db.users.deleteMany({});`,
+			expected: []interface{}{
+				primitive.D{{Key: "delete", Value: "users"}, {Key: "deletes", Value: primitive.A{primitive.D{
+					{Key: "q", Value: primitive.D{{Key: "_id", Value: int32(1)}}}, {Key: "limit", Value: int32(1)},
+				}}}},
+				primitive.D{{Key: "delete", Value: "users"}, {Key: "deletes", Value: primitive.A{primitive.D{
+					{Key: "q", Value: primitive.D{}}, {Key: "limit", Value: int32(0)},
+				}}}},
+			},
+		},
+		{
+			name:   "createIndex",
+			script: `db.users.createIndex({email: 1, created: -1}, {unique: true});`,
+			expected: []interface{}{primitive.D{{Key: "createIndexes", Value: "users"}, {Key: "indexes", Value: primitive.A{primitive.D{
+				{Key: "key", Value: primitive.D{{Key: "email", Value: int32(1)}, {Key: "created", Value: int32(-1)}}},
+				{Key: "name", Value: "email_1_created_-1"},
+				{Key: "unique", Value: true},
+			}}}}},
+		},
+		{
+			name:   "constructors",
+			script: `db.users.insertOne({day: ISODate("2019-10-01"), at: ISODate("2019-10-01T10:00:00Z"), long: NumberLong("5"), int: NumberInt(7)});`,
+			expected: []interface{}{primitive.D{{Key: "insert", Value: "users"}, {Key: "documents", Value: primitive.A{primitive.D{
+				{Key: "day", Value: time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC)},
+				{Key: "at", Value: time.Date(2019, 10, 1, 10, 0, 0, 0, time.UTC)},
+				{Key: "long", Value: int64(5)},
+				{Key: "int", Value: int32(7)},
+			}}}}},
+		},
+	}
+	for _, c := range cases {
+		collector := &commandCollector{}
+		err := runTestScript(c.script, collector)
+		if err != nil {
+			t.Errorf("%v: script failed: %v", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(collector.commands, c.expected) {
+			t.Errorf("%v: unexpected commands.\nExpected: %v\nGot:      %v", c.name, c.expected, collector.commands)
+		}
+	}
+}
+
+func TestJSMigrationErrors(t *testing.T) {
+	cases := []struct {
+		name     string
+		script   string
+		expected string
+	}{
+		{
+			name:     "failed command",
+			script:   `db.users.insertOne({_id: 1});`,
+			expected: "Failed to insert into 'users'",
+		},
+		{
+			name:     "invalid date",
+			script:   `db.items.insertOne({at: ISODate("yesterday")});`,
+			expected: "Invalid date-time 'yesterday'",
+		},
+		{
+			name:     "invalid documents",
+			script:   `db.items.insertMany({_id: 1});`,
+			expected: "documents must be an array",
+		},
+		{
+			name:     "function in document",
+			script:   `db.items.insertOne({f: function() {}});`,
+			expected: "functions can't be stored in documents",
+		},
+		{
+			name:     "missing index keys",
+			script:   `db.items.createIndex({});`,
+			expected: "Field 'keys' must not be empty",
+		},
+	}
+	for _, c := range cases {
+		err := runTestScript(c.script, &recordingApplier{failOn: "users"})
+		if err == nil {
+			t.Errorf("%v: expected script to fail", c.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), c.expected) {
+			t.Errorf("%v: expected error with '%v', got: %v", c.name, c.expected, err)
+		}
+	}
+}
+
+func TestJSMigrationErrorsCanBeCaught(t *testing.T) {
+	applier := &recordingApplier{failOn: "users"}
+	err := runTestScript(`try { db.users.insertOne({_id: 1}); } catch (e) { db.fallback.insertOne({_id: 1}); }`, applier)
+	if err != nil {
+		t.Fatalf("Script failed: %v", err)
+	}
+	expected := []string{"insert users", "insert fallback"}
+	if !reflect.DeepEqual(applier.applied, expected) {
+		t.Errorf("Expected %v, got %v", expected, applier.applied)
+	}
+}
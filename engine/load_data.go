@@ -0,0 +1,471 @@
+package engine
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coldze/primitives/custom_error"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	LOAD_DATA_FORMAT_CSV    = "csv"
+	LOAD_DATA_FORMAT_NDJSON = "ndjson"
+	loadDataDefaultBatch    = 1000
+	loadDataMaxLineSize     = 16 * 1024 * 1024
+)
+
+type columnConverter func(value string) (interface{}, error)
+
+var columnConverters = map[string]columnConverter{
+	"string": func(value string) (interface{}, error) {
+		return value, nil
+	},
+	"int": func(value string) (interface{}, error) {
+		v, err := strconv.ParseInt(value, 10, 32)
+		return int32(v), err
+	},
+	"long": func(value string) (interface{}, error) {
+		return strconv.ParseInt(value, 10, 64)
+	},
+	"double": func(value string) (interface{}, error) {
+		return strconv.ParseFloat(value, 64)
+	},
+	"bool": func(value string) (interface{}, error) {
+		return strconv.ParseBool(value)
+	},
+	"date": func(value string) (interface{}, error) {
+		date, err := time.Parse(time.RFC3339Nano, value)
+		if err == nil {
+			return date, nil
+		}
+		return time.Parse("2006-01-02", value)
+	},
+	"objectId": func(value string) (interface{}, error) {
+		return primitive.ObjectIDFromHex(value)
+	},
+	"decimal": func(value string) (interface{}, error) {
+		return primitive.ParseDecimal128(value)
+	},
+}
+
+// LoadDataMigration streams CSV or NDJSON file into collection by batches.
+// Documents without _id get ObjectID derived from file's checksum and row number,
+// so generated rollback is able to delete them.
+type LoadDataMigration struct {
+	path       string
+	collection string
+	format     string
+	separator  rune
+	batchSize  int
+	columns    map[string]columnConverter
+	upsertKey  string
+	checksum   []byte
+}
+
+func getParam(params primitive.D, key string) (interface{}, bool) {
+	for i := range params {
+		if params[i].Key == key {
+			return params[i].Value, true
+		}
+	}
+	return nil, false
+}
+
+func getStringParam(params primitive.D, key string, required bool) (string, custom_error.CustomError) {
+	value, ok := getParam(params, key)
+	if !ok {
+		if required {
+			return "", custom_error.MakeErrorf("Field '%v' is required", key)
+		}
+		return "", nil
+	}
+	str, ok := value.(string)
+	if !ok {
+		return "", custom_error.MakeErrorf("Field '%v' must be a string. Type: %T", key, value)
+	}
+	return str, nil
+}
+
+func getLoadDataFormat(path string, format string) (string, custom_error.CustomError) {
+	if len(format) <= 0 {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".csv":
+			return LOAD_DATA_FORMAT_CSV, nil
+		case ".ndjson", ".jsonl":
+			return LOAD_DATA_FORMAT_NDJSON, nil
+		}
+		return "", custom_error.MakeErrorf("Can't detect format of '%v'. Specify 'format': csv or ndjson", path)
+	}
+	format = strings.ToLower(format)
+	if format != LOAD_DATA_FORMAT_CSV && format != LOAD_DATA_FORMAT_NDJSON {
+		return "", custom_error.MakeErrorf("Unknown format '%v'. Expected csv or ndjson", format)
+	}
+	return format, nil
+}
+
+func getBatchSize(params primitive.D) (int, custom_error.CustomError) {
+	value, ok := getParam(params, "batchSize")
+	if !ok {
+		return loadDataDefaultBatch, nil
+	}
+	batchSize := 0
+	switch typed := value.(type) {
+	case int32:
+		batchSize = int(typed)
+	case int64:
+		batchSize = int(typed)
+	case float64:
+		batchSize = int(typed)
+	default:
+		return 0, custom_error.MakeErrorf("Field 'batchSize' must be a number. Type: %T", value)
+	}
+	if batchSize <= 0 {
+		return 0, custom_error.MakeErrorf("Field 'batchSize' must be positive. Value: %v", batchSize)
+	}
+	return batchSize, nil
+}
+
+func getColumns(params primitive.D) (map[string]columnConverter, custom_error.CustomError) {
+	columns := map[string]columnConverter{}
+	value, ok := getParam(params, "columns")
+	if !ok {
+		return columns, nil
+	}
+	doc, ok := value.(primitive.D)
+	if !ok {
+		return nil, custom_error.MakeErrorf("Field 'columns' must be a document. Type: %T", value)
+	}
+	for i := range doc {
+		typeName, ok := doc[i].Value.(string)
+		if !ok {
+			return nil, custom_error.MakeErrorf("Type of column '%v' must be a string. Type: %T", doc[i].Key, doc[i].Value)
+		}
+		converter, ok := columnConverters[typeName]
+		if !ok {
+			return nil, custom_error.MakeErrorf("Unknown type '%v' of column '%v'. Expected one of: string, int, long, double, bool, date, objectId, decimal", typeName, doc[i].Key)
+		}
+		columns[doc[i].Key] = converter
+	}
+	return columns, nil
+}
+
+func NewLoadDataMigration(params primitive.D, migrationDir string, checksum *ChangeChecksum) (*LoadDataMigration, custom_error.CustomError) {
+	collection, err := getStringParam(params, "collection", true)
+	if err != nil {
+		return nil, err
+	}
+	file, err := getStringParam(params, "file", true)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(migrationDir, file)
+	format, err := getStringParam(params, "format", false)
+	if err != nil {
+		return nil, err
+	}
+	format, err = getLoadDataFormat(path, format)
+	if err != nil {
+		return nil, err
+	}
+	separator := ','
+	separatorValue, err := getStringParam(params, "separator", false)
+	if err != nil {
+		return nil, err
+	}
+	if len(separatorValue) > 0 {
+		separator = []rune(separatorValue)[0]
+	}
+	batchSize, err := getBatchSize(params)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := getColumns(params)
+	if err != nil {
+		return nil, err
+	}
+	upsertKey, err := getStringParam(params, "upsertKey", false)
+	if err != nil {
+		return nil, err
+	}
+	input, ioErr := os.Open(path)
+	if ioErr != nil {
+		return nil, custom_error.MakeErrorf("Failed to open data file '%v'. Error: %v", path, ioErr)
+	}
+	defer input.Close()
+	fileHash := md5.New()
+	_, ioErr = io.Copy(io.MultiWriter(fileHash, checksum.textWriter()), input)
+	if ioErr != nil {
+		return nil, custom_error.MakeErrorf("Failed to read data file '%v'. Error: %v", path, ioErr)
+	}
+	return &LoadDataMigration{
+		path:       path,
+		collection: collection,
+		format:     format,
+		separator:  separator,
+		batchSize:  batchSize,
+		columns:    columns,
+		upsertKey:  upsertKey,
+		checksum:   fileHash.Sum(nil),
+	}, nil
+}
+
+func (l *LoadDataMigration) convert(field string, value string) (interface{}, custom_error.CustomError) {
+	converter, ok := l.columns[field]
+	if !ok {
+		return value, nil
+	}
+	converted, err := converter(value)
+	if err != nil {
+		return nil, custom_error.MakeErrorf("Failed to convert value '%v' of field '%v'. Error: %v", value, field, err)
+	}
+	return converted, nil
+}
+
+func (l *LoadDataMigration) convertDocument(doc primitive.D) (primitive.D, custom_error.CustomError) {
+	for i := range doc {
+		str, ok := doc[i].Value.(string)
+		if !ok {
+			continue
+		}
+		converted, err := l.convert(doc[i].Key, str)
+		if err != nil {
+			return nil, err
+		}
+		doc[i].Value = converted
+	}
+	return doc, nil
+}
+
+func (l *LoadDataMigration) newID(row int) primitive.ObjectID {
+	rowHash := md5.New()
+	rowHash.Write(l.checksum)
+	fmt.Fprintf(rowHash, ":%v:%v", l.collection, row)
+	id := primitive.ObjectID{}
+	copy(id[:], rowHash.Sum(nil))
+	return id
+}
+
+func (l *LoadDataMigration) withID(doc primitive.D, row int) primitive.D {
+	_, ok := getParam(doc, "_id")
+	if ok {
+		return doc
+	}
+	return append(primitive.D{{Key: "_id", Value: l.newID(row)}}, doc...)
+}
+
+func (l *LoadDataMigration) flush(batch primitive.A, visitor DocumentApplier) custom_error.CustomError {
+	if len(batch) <= 0 {
+		return nil
+	}
+	if len(l.upsertKey) <= 0 {
+		return visitor.Apply(primitive.D{{Key: "insert", Value: l.collection}, {Key: "documents", Value: batch}})
+	}
+	updates := make(primitive.A, 0, len(batch))
+	for i := range batch {
+		doc := batch[i].(primitive.D)
+		key, ok := getParam(doc, l.upsertKey)
+		if !ok {
+			return custom_error.MakeErrorf("Document has no upsert key '%v'", l.upsertKey)
+		}
+		updates = append(updates, primitive.D{
+			{Key: "q", Value: primitive.D{{Key: l.upsertKey, Value: key}}},
+			{Key: "u", Value: doc},
+			{Key: "upsert", Value: true},
+		})
+	}
+	return visitor.Apply(primitive.D{{Key: "update", Value: l.collection}, {Key: "updates", Value: updates}})
+}
+
+func (l *LoadDataMigration) readCSV(input io.Reader, consume func(doc primitive.D) custom_error.CustomError) custom_error.CustomError {
+	reader := csv.NewReader(input)
+	reader.Comma = l.separator
+	header, err := reader.Read()
+	if err != nil {
+		return custom_error.MakeErrorf("Failed to read header. Error: %v", err)
+	}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return custom_error.MakeErrorf("Failed to read line %v. Error: %v", line, err)
+		}
+		doc := primitive.D{}
+		for i := range record {
+			if len(record[i]) <= 0 {
+				continue
+			}
+			value, errValue := l.convert(header[i], record[i])
+			if errValue != nil {
+				return custom_error.NewErrorf(errValue, "Invalid value at line %v", line)
+			}
+			doc = append(doc, primitive.E{Key: header[i], Value: value})
+		}
+		errValue := consume(doc)
+		if errValue != nil {
+			return errValue
+		}
+	}
+}
+
+func (l *LoadDataMigration) readNDJSON(input io.Reader, consume func(doc primitive.D) custom_error.CustomError) custom_error.CustomError {
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64*1024), loadDataMaxLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		data := scanner.Bytes()
+		if len(strings.TrimSpace(string(data))) <= 0 {
+			continue
+		}
+		doc := primitive.D{}
+		err := bson.UnmarshalExtJSON(data, false, &doc)
+		if err != nil {
+			return custom_error.MakeErrorf("Failed to decode line %v. Error: %v", line, err)
+		}
+		doc, errValue := l.convertDocument(doc)
+		if errValue != nil {
+			return custom_error.NewErrorf(errValue, "Invalid value at line %v", line)
+		}
+		errValue = consume(doc)
+		if errValue != nil {
+			return errValue
+		}
+	}
+	err := scanner.Err()
+	if err != nil {
+		return custom_error.MakeErrorf("Failed to read file. Error: %v", err)
+	}
+	return nil
+}
+
+func (l *LoadDataMigration) read(consume func(doc primitive.D) custom_error.CustomError) custom_error.CustomError {
+	input, err := os.Open(l.path)
+	if err != nil {
+		return custom_error.MakeErrorf("Failed to open data file '%v'. Error: %v", l.path, err)
+	}
+	defer input.Close()
+	if l.format == LOAD_DATA_FORMAT_NDJSON {
+		return l.readNDJSON(input, consume)
+	}
+	return l.readCSV(input, consume)
+}
+
+func (l *LoadDataMigration) Apply(visitor DocumentApplier) custom_error.CustomError {
+	batch := primitive.A{}
+	row := 0
+	consume := func(doc primitive.D) custom_error.CustomError {
+		if len(l.upsertKey) <= 0 {
+			doc = l.withID(doc, row)
+		}
+		row++
+		batch = append(batch, doc)
+		if len(batch) < l.batchSize {
+			return nil
+		}
+		errValue := l.flush(batch, visitor)
+		batch = primitive.A{}
+		return errValue
+	}
+	errValue := l.read(consume)
+	if errValue == nil {
+		errValue = l.flush(batch, visitor)
+	}
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to load data from '%v' into '%v'", l.path, l.collection)
+	}
+	return nil
+}
+
+func (l *LoadDataMigration) invert() (Migration, custom_error.CustomError) {
+	return &loadDataRollback{
+		loader: l,
+	}, nil
+}
+
+// loadDataRollback streams data file and deletes loaded documents batch by batch: by `_id`, the same as used for
+// inserting them, or by upsert key.
+type loadDataRollback struct {
+	loader *LoadDataMigration
+}
+
+func (r *loadDataRollback) flush(key string, values primitive.A, visitor DocumentApplier) custom_error.CustomError {
+	if len(values) <= 0 {
+		return nil
+	}
+	return visitor.Apply(primitive.D{
+		{Key: "delete", Value: r.loader.collection},
+		{Key: "deletes", Value: primitive.A{
+			primitive.D{
+				{Key: "q", Value: primitive.D{{Key: key, Value: primitive.D{{Key: "$in", Value: values}}}}},
+				{Key: "limit", Value: int32(0)},
+			},
+		}},
+	})
+}
+
+func (r *loadDataRollback) Apply(visitor DocumentApplier) custom_error.CustomError {
+	l := r.loader
+	key := "_id"
+	if len(l.upsertKey) > 0 {
+		key = l.upsertKey
+	}
+	values := primitive.A{}
+	row := 0
+	consume := func(doc primitive.D) custom_error.CustomError {
+		if len(l.upsertKey) <= 0 {
+			doc = l.withID(doc, row)
+		}
+		row++
+		value, ok := getParam(doc, key)
+		if !ok {
+			return custom_error.MakeErrorf("Document has no key '%v'", key)
+		}
+		values = append(values, value)
+		if len(values) < l.batchSize {
+			return nil
+		}
+		errValue := r.flush(key, values, visitor)
+		values = primitive.A{}
+		return errValue
+	}
+	errValue := l.read(consume)
+	if errValue == nil {
+		errValue = r.flush(key, values, visitor)
+	}
+	if errValue != nil {
+		return custom_error.NewErrorf(errValue, "Failed to delete data of '%v' from '%v'", l.path, l.collection)
+	}
+	return nil
+}
+
+// resolveLoadData replaces {"loadData": {...}} entries with migrations, that read data files on apply.
+func resolveLoadData(commands []interface{}, migrationDir string, checksum *ChangeChecksum) ([]interface{}, custom_error.CustomError) {
+	res := make([]interface{}, 0, len(commands))
+	for i := range commands {
+		doc, ok := commands[i].(primitive.D)
+		if !ok || len(doc) != 1 || doc[0].Key != "loadData" {
+			res = append(res, commands[i])
+			continue
+		}
+		params, ok := doc[0].Value.(primitive.D)
+		if !ok {
+			return nil, custom_error.MakeErrorf("Change 'loadData' at position %v must be a document. Type: %T", i, doc[0].Value)
+		}
+		loader, err := NewLoadDataMigration(params, migrationDir, checksum)
+		if err != nil {
+			return nil, custom_error.NewErrorf(err, "Invalid 'loadData' change at position %v", i)
+		}
+		res = append(res, loader)
+	}
+	return res, nil
+}
@@ -0,0 +1,100 @@
+package engine
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const loadDataTestCSV = "code,name\na,first\nb,second\nc,third\n"
+
+func newTestLoadData(t *testing.T, upsertKey string) (*LoadDataMigration, func()) {
+	dir, err := ioutil.TempDir("", "mongol-load-data")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "data.csv"), []byte(loadDataTestCSV), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write data file: %v", err)
+	}
+	params := primitive.D{{Key: "collection", Value: "items"}, {Key: "file", Value: "data.csv"}, {Key: "batchSize", Value: int32(2)}}
+	if len(upsertKey) > 0 {
+		params = append(params, primitive.E{Key: "upsertKey", Value: upsertKey})
+	}
+	loader, errValue := NewLoadDataMigration(params, dir, NewChangeChecksum())
+	if errValue != nil {
+		t.Fatalf("Failed to create migration: %v", errValue)
+	}
+	return loader, func() { os.RemoveAll(dir) }
+}
+
+func deletedValues(t *testing.T, commands []interface{}, key string) primitive.A {
+	values := primitive.A{}
+	for _, command := range commands {
+		doc := command.(primitive.D)
+		if doc[0].Key != "delete" {
+			t.Fatalf("Unexpected command: %v", doc)
+		}
+		deletes := doc[1].Value.(primitive.A)
+		q := deletes[0].(primitive.D)[0].Value.(primitive.D)
+		if q[0].Key != key {
+			t.Fatalf("Unexpected delete filter: %v", q)
+		}
+		values = append(values, q[0].Value.(primitive.D)[0].Value.(primitive.A)...)
+	}
+	return values
+}
+
+func TestLoadDataRollbackDeletesInsertedDocuments(t *testing.T) {
+	loader, cleanup := newTestLoadData(t, "")
+	defer cleanup()
+	forward := &commandCollector{}
+	errValue := loader.Apply(forward)
+	if errValue != nil {
+		t.Fatalf("Failed to apply: %v", errValue)
+	}
+	inserted := primitive.A{}
+	for _, command := range forward.commands {
+		for _, doc := range command.(primitive.D)[1].Value.(primitive.A) {
+			inserted = append(inserted, doc.(primitive.D)[0].Value)
+		}
+	}
+	rollback, errValue := newGeneratedRollback(&SimpleMigration{commands: []interface{}{loader}})
+	if errValue != nil {
+		t.Fatalf("Failed to generate rollback: %v", errValue)
+	}
+	backward := &commandCollector{}
+	errValue = rollback.Apply(backward)
+	if errValue != nil {
+		t.Fatalf("Failed to apply rollback: %v", errValue)
+	}
+	if len(backward.commands) != 2 {
+		t.Errorf("Expected 2 batches, got %v", len(backward.commands))
+	}
+	deleted := deletedValues(t, backward.commands, "_id")
+	if len(inserted) != 3 || !reflect.DeepEqual(inserted, deleted) {
+		t.Errorf("Rollback deletes %v, inserted %v", deleted, inserted)
+	}
+}
+
+func TestLoadDataRollbackDeletesByUpsertKey(t *testing.T) {
+	loader, cleanup := newTestLoadData(t, "code")
+	defer cleanup()
+	rollback, errValue := newGeneratedRollback(&SimpleMigration{commands: []interface{}{loader}})
+	if errValue != nil {
+		t.Fatalf("Failed to generate rollback: %v", errValue)
+	}
+	backward := &commandCollector{}
+	errValue = rollback.Apply(backward)
+	if errValue != nil {
+		t.Fatalf("Failed to apply rollback: %v", errValue)
+	}
+	deleted := deletedValues(t, backward.commands, "code")
+	if !reflect.DeepEqual(deleted, primitive.A{"a", "b", "c"}) {
+		t.Errorf("Rollback deletes %v", deleted)
+	}
+}
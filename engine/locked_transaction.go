@@ -0,0 +1,48 @@
+package engine
+
+import (
+	"github.com/coldze/primitives/custom_error"
+)
+
+// lockedTransaction refuses to apply changes after migration lock is lost, as another instance may already be
+// migrating the same database.
+type lockedTransaction struct {
+	Transaction
+	lost <-chan struct{}
+}
+
+func (t *lockedTransaction) isLost() bool {
+	select {
+	case <-t.lost:
+		return true
+	default:
+		return false
+	}
+}
+
+func (t *lockedTransaction) Apply(change *Change) custom_error.CustomError {
+	if t.isLost() {
+		return custom_error.MakeErrorf("Migration lock was lost. Change '%v' is not applied.", change.ID)
+	}
+	return t.Transaction.Apply(change)
+}
+
+func (t *lockedTransaction) Commit() custom_error.CustomError {
+	if t.isLost() {
+		return custom_error.MakeErrorf("Migration lock was lost. Transaction is not committed.")
+	}
+	return t.Transaction.Commit()
+}
+
+func NewLockedTransactionFactory(startTransaction TransactionFactory, lost <-chan struct{}) TransactionFactory {
+	return func(changeSet *ChangeSet) (Transaction, custom_error.CustomError) {
+		transaction, err := startTransaction(changeSet)
+		if err != nil {
+			return nil, err
+		}
+		return &lockedTransaction{
+			Transaction: transaction,
+			lost:        lost,
+		}, nil
+	}
+}
@@ -0,0 +1,199 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/coldze/mongol/engine/decoding"
+	"github.com/coldze/primitives/custom_error"
+)
+
+const (
+	PRECONDITION_ON_FAIL_HALT     = "HALT"
+	PRECONDITION_ON_FAIL_CONTINUE = "CONTINUE"
+	PRECONDITION_ON_FAIL_MARK_RAN = "MARK_RAN"
+	PRECONDITION_ON_FAIL_WARN     = "WARN"
+)
+
+type IndexExistsCondition struct {
+	Collection string `json:"collection"`
+	Name       string `json:"name"`
+}
+
+type DocumentCountCondition struct {
+	Collection string          `json:"collection"`
+	RawFilter  json.RawMessage `json:"filter,omitempty"`
+	Count      int64           `json:"count"`
+	Filter     interface{}     `json:"-"`
+}
+
+type FieldExistsCondition struct {
+	Collection string `json:"collection"`
+	Field      string `json:"field"`
+}
+
+type ServerVersionCondition struct {
+	Min string `json:"min,omitempty"`
+	Max string `json:"max,omitempty"`
+}
+
+type Precondition struct {
+	Not              bool                    `json:"not,omitempty"`
+	CollectionExists string                  `json:"collectionExists,omitempty"`
+	IndexExists      *IndexExistsCondition   `json:"indexExists,omitempty"`
+	DocumentCount    *DocumentCountCondition `json:"documentCount,omitempty"`
+	FieldExists      *FieldExistsCondition   `json:"fieldExists,omitempty"`
+	ServerVersion    *ServerVersionCondition `json:"serverVersion,omitempty"`
+}
+
+type Preconditions struct {
+	OnFail string          `json:"onFail,omitempty"`
+	Checks []*Precondition `json:"checks"`
+}
+
+// PreconditionChecker evaluates a single check against the database, ignoring Not.
+type PreconditionChecker interface {
+	Check(precondition *Precondition) (bool, custom_error.CustomError)
+}
+
+func (p *Precondition) String() string {
+	description := ""
+	switch {
+	case len(p.CollectionExists) > 0:
+		description = fmt.Sprintf("collectionExists '%v'", p.CollectionExists)
+	case p.IndexExists != nil:
+		description = fmt.Sprintf("indexExists '%v' on '%v'", p.IndexExists.Name, p.IndexExists.Collection)
+	case p.DocumentCount != nil:
+		description = fmt.Sprintf("documentCount %v in '%v' matching %s", p.DocumentCount.Count, p.DocumentCount.Collection, string(p.DocumentCount.RawFilter))
+	case p.FieldExists != nil:
+		description = fmt.Sprintf("fieldExists '%v' in '%v'", p.FieldExists.Field, p.FieldExists.Collection)
+	case p.ServerVersion != nil:
+		description = fmt.Sprintf("serverVersion in ['%v', '%v']", p.ServerVersion.Min, p.ServerVersion.Max)
+	}
+	if p.Not {
+		return "not " + description
+	}
+	return description
+}
+
+func (p *Precondition) validate() custom_error.CustomError {
+	kinds := 0
+	if len(p.CollectionExists) > 0 {
+		kinds++
+	}
+	if p.IndexExists != nil {
+		kinds++
+		if len(p.IndexExists.Collection) <= 0 || len(p.IndexExists.Name) <= 0 {
+			return custom_error.MakeErrorf("'indexExists' requires 'collection' and 'name'")
+		}
+	}
+	if p.DocumentCount != nil {
+		kinds++
+		if len(p.DocumentCount.Collection) <= 0 {
+			return custom_error.MakeErrorf("'documentCount' requires 'collection'")
+		}
+		p.DocumentCount.Filter = map[string]interface{}{}
+		if len(p.DocumentCount.RawFilter) > 0 {
+			filter, err := decoding.DecodeExt(p.DocumentCount.RawFilter)
+			if err != nil {
+				return custom_error.NewErrorf(err, "'documentCount' has invalid 'filter'")
+			}
+			p.DocumentCount.Filter = filter
+		}
+	}
+	if p.FieldExists != nil {
+		kinds++
+		if len(p.FieldExists.Collection) <= 0 || len(p.FieldExists.Field) <= 0 {
+			return custom_error.MakeErrorf("'fieldExists' requires 'collection' and 'field'")
+		}
+	}
+	if p.ServerVersion != nil {
+		kinds++
+		if len(p.ServerVersion.Min) <= 0 && len(p.ServerVersion.Max) <= 0 {
+			return custom_error.MakeErrorf("'serverVersion' requires 'min' or 'max'")
+		}
+		_, err := ParseVersion(p.ServerVersion.Min)
+		if err != nil {
+			return custom_error.NewErrorf(err, "'serverVersion' has invalid 'min'")
+		}
+		_, err = ParseVersion(p.ServerVersion.Max)
+		if err != nil {
+			return custom_error.NewErrorf(err, "'serverVersion' has invalid 'max'")
+		}
+	}
+	if kinds != 1 {
+		return custom_error.MakeErrorf("Precondition must specify exactly one check. Specified: %v", kinds)
+	}
+	return nil
+}
+
+func (p *Preconditions) validate() custom_error.CustomError {
+	if len(p.OnFail) <= 0 {
+		p.OnFail = PRECONDITION_ON_FAIL_HALT
+	}
+	p.OnFail = strings.ToUpper(p.OnFail)
+	switch p.OnFail {
+	case PRECONDITION_ON_FAIL_HALT, PRECONDITION_ON_FAIL_CONTINUE, PRECONDITION_ON_FAIL_MARK_RAN, PRECONDITION_ON_FAIL_WARN:
+	default:
+		return custom_error.MakeErrorf("Unknown 'onFail' value '%v'. Expected one of: HALT, CONTINUE, MARK_RAN, WARN", p.OnFail)
+	}
+	for i := range p.Checks {
+		if p.Checks[i] == nil {
+			return custom_error.MakeErrorf("Empty precondition at position %v", i)
+		}
+		err := p.Checks[i].validate()
+		if err != nil {
+			return custom_error.NewErrorf(err, "Invalid precondition at position %v", i)
+		}
+	}
+	return nil
+}
+
+// Evaluate returns description of the first failed check or empty string, if every check passed.
+func (p *Preconditions) Evaluate(checker PreconditionChecker) (string, custom_error.CustomError) {
+	for _, precondition := range p.Checks {
+		ok, err := checker.Check(precondition)
+		if err != nil {
+			return "", custom_error.NewErrorf(err, "Failed to check precondition %v", precondition)
+		}
+		if ok == precondition.Not {
+			return precondition.String(), nil
+		}
+	}
+	return "", nil
+}
+
+// ParseVersion parses dotted version like "4.0.3". Empty string gives empty version.
+func ParseVersion(value string) ([]int, custom_error.CustomError) {
+	version := []int{}
+	if len(value) <= 0 {
+		return version, nil
+	}
+	for _, part := range strings.Split(value, ".") {
+		number := 0
+		_, err := fmt.Sscanf(part, "%d", &number)
+		if err != nil {
+			return nil, custom_error.MakeErrorf("Invalid version '%v'. Error: %v", value, err)
+		}
+		version = append(version, number)
+	}
+	return version, nil
+}
+
+// CompareVersions compares only components present in bound, so "4.2.5" equals to bound "4.2".
+func CompareVersions(version []int, bound []int) int {
+	for i := range bound {
+		value := 0
+		if i < len(version) {
+			value = version[i]
+		}
+		if value < bound[i] {
+			return -1
+		}
+		if value > bound[i] {
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,263 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/coldze/mongol/engine/decoding"
+	"github.com/coldze/primitives/custom_error"
+)
+
+const (
+	propertyOpen    = "${"
+	propertyEscaped = "$${"
+	propertyClose   = '}'
+	propertyDefault = ':'
+)
+
+const (
+	syntaxJSON = iota
+	syntaxShell
+	syntaxYAML
+)
+
+type Properties map[string]string
+
+// literalTracker follows string literals and comments of file, so values, substituted inside of strings, are escaped
+// and can't break the document or inject fields.
+type literalTracker struct {
+	syntax   int
+	quote    byte
+	escaped  bool
+	comment  byte
+	last     byte
+	previous byte
+}
+
+func newLiteralTracker(path string) *literalTracker {
+	syntax := syntaxJSON
+	if decoding.IsYAML(path) {
+		syntax = syntaxYAML
+	} else if decoding.IsShellSyntax(path) {
+		syntax = syntaxShell
+	}
+	return &literalTracker{syntax: syntax}
+}
+
+func (t *literalTracker) opensQuote(c byte, last byte) bool {
+	if c == '\'' && t.syntax == syntaxJSON {
+		return false
+	}
+	if t.syntax != syntaxYAML {
+		return true
+	}
+	// in YAML quotes start only scalars, "don't" in plain scalar is not a string; '' is escaped quote in single-quoted one
+	return t.previous == 0 || strings.IndexByte(":-[{,?", t.previous) >= 0 || (c == '\'' && last == '\'')
+}
+
+func (t *literalTracker) next(c byte) {
+	last := t.last
+	t.last = c
+	if t.comment != 0 {
+		if (t.comment != '*' && c == '\n') || (t.comment == '*' && last == '*' && c == '/') {
+			t.comment = 0
+			t.last = 0
+			t.previous = 0
+		}
+		return
+	}
+	if t.quote != 0 {
+		if t.escaped {
+			t.escaped = false
+			return
+		}
+		if c == '\\' && (t.syntax != syntaxYAML || t.quote == '"') {
+			t.escaped = true
+			return
+		}
+		if c == t.quote {
+			t.quote = 0
+			t.previous = c
+		}
+		return
+	}
+	switch {
+	case c == '\n':
+		t.previous = 0
+	case c == ' ' || c == '\t' || c == '\r':
+	case t.syntax != syntaxYAML && last == '/' && (c == '/' || c == '*'):
+		t.comment = c
+		t.last = 0
+	case t.syntax == syntaxYAML && c == '#' && (last == 0 || last == ' ' || last == '\t' || last == '\n'):
+		t.comment = c
+	case (c == '"' || c == '\'') && t.opensQuote(c, last):
+		t.quote = c
+		t.previous = c
+	default:
+		t.previous = c
+	}
+}
+
+func (t *literalTracker) advance(data []byte) {
+	for _, c := range data {
+		t.next(c)
+	}
+}
+
+// substituted is called after value was written instead of property reference.
+func (t *literalTracker) substituted() {
+	t.last = propertyClose
+	if t.quote == 0 && t.comment == 0 {
+		t.previous = propertyClose
+	}
+}
+
+func (t *literalTracker) escape(value string) string {
+	if t.quote == 0 {
+		return value
+	}
+	if t.syntax == syntaxYAML && t.quote == '\'' {
+		return strings.Replace(value, "'", "''", -1)
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	escaped := string(encoded[1 : len(encoded)-1])
+	if t.quote == '\'' {
+		escaped = strings.Replace(escaped, "'", "\\'", -1)
+	}
+	return escaped
+}
+
+func (p Properties) Lookup(name string) (string, bool) {
+	value, ok := p[name]
+	if ok {
+		return value, true
+	}
+	return os.LookupEnv(name)
+}
+
+func (p Properties) resolve(expression string) (string, custom_error.CustomError) {
+	name := expression
+	defaultValue := ""
+	hasDefault := false
+	index := strings.IndexByte(expression, propertyDefault)
+	if index >= 0 {
+		name = expression[:index]
+		defaultValue = expression[index+1:]
+		hasDefault = true
+	}
+	name = strings.TrimSpace(name)
+	if len(name) <= 0 {
+		return "", custom_error.MakeErrorf("Empty property name in '${%v}'", expression)
+	}
+	value, ok := p.Lookup(name)
+	if ok {
+		return value, nil
+	}
+	if hasDefault {
+		return defaultValue, nil
+	}
+	return "", custom_error.MakeErrorf("Property '%v' is not defined", name)
+}
+
+// Substitute replaces property references with values. Values, referenced inside of string literals, are escaped for them,
+// references outside of strings are replaced as is, e.g. `"count": ${COUNT}`, references in comments are not resolved.
+// Returned source map points decoding errors back into data.
+func (p Properties) Substitute(path string, data []byte) ([]byte, *decoding.SourceMap, custom_error.CustomError) {
+	if !bytes.Contains(data, []byte(propertyOpen)) {
+		return data, nil, nil
+	}
+	tracker := newLiteralTracker(path)
+	res := bytes.Buffer{}
+	substitutions := []decoding.Substitution{}
+	rest := data
+	for {
+		index := bytes.Index(rest, []byte(propertyOpen))
+		if index < 0 {
+			res.Write(rest)
+			return res.Bytes(), decoding.NewSourceMap(data, substitutions), nil
+		}
+		if index > 0 && rest[index-1] == '$' {
+			tracker.advance(rest[:index+len(propertyOpen)])
+			res.Write(rest[:index-1])
+			substitutions = append(substitutions, decoding.Substitution{
+				Offset:    int64(res.Len()),
+				Length:    int64(len(propertyOpen)),
+				RawOffset: int64(len(data) - len(rest) + index - 1),
+				RawLength: int64(len(propertyEscaped)),
+			})
+			res.WriteString(propertyOpen)
+			rest = rest[index+len(propertyOpen):]
+			continue
+		}
+		tracker.advance(rest[:index])
+		res.Write(rest[:index])
+		rawOffset := len(data) - len(rest) + index
+		rest = rest[index+len(propertyOpen):]
+		if tracker.comment != 0 {
+			// references in comments are left as is, so commented out lines don't require properties
+			tracker.advance([]byte(propertyOpen))
+			res.WriteString(propertyOpen)
+			continue
+		}
+		end := bytes.IndexByte(rest, propertyClose)
+		if end < 0 {
+			return nil, nil, custom_error.MakeErrorf("Unterminated property reference: '%v%v'", propertyOpen, string(rest))
+		}
+		value, err := p.resolve(string(rest[:end]))
+		if err != nil {
+			return nil, nil, custom_error.NewErrorf(err, "Failed to substitute property")
+		}
+		escaped := tracker.escape(value)
+		substitutions = append(substitutions, decoding.Substitution{
+			Offset:    int64(res.Len()),
+			Length:    int64(len(escaped)),
+			RawOffset: int64(rawOffset),
+			RawLength: int64(len(propertyOpen) + end + 1),
+		})
+		res.WriteString(escaped)
+		tracker.substituted()
+		rest = rest[end+1:]
+	}
+}
+
+func ParseProperty(property string) (string, string, custom_error.CustomError) {
+	index := strings.IndexByte(property, '=')
+	if index <= 0 {
+		return "", "", custom_error.MakeErrorf("Invalid property '%v'. Expected format: key=value", property)
+	}
+	return strings.TrimSpace(property[:index]), strings.TrimSpace(property[index+1:]), nil
+}
+
+func LoadProperties(path string) (Properties, custom_error.CustomError) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, custom_error.MakeErrorf("Failed to open properties file '%v'. Error: %v", path, err)
+	}
+	defer file.Close()
+	properties := Properties{}
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) <= 0 || text[0] == '#' || text[0] == '!' {
+			continue
+		}
+		key, value, errValue := ParseProperty(text)
+		if errValue != nil {
+			return nil, custom_error.NewErrorf(errValue, "Failed to parse properties file '%v' at line %v", path, line)
+		}
+		properties[key] = value
+	}
+	err = scanner.Err()
+	if err != nil {
+		return nil, custom_error.MakeErrorf("Failed to read properties file '%v'. Error: %v", path, err)
+	}
+	return properties, nil
+}
@@ -0,0 +1,88 @@
+package engine
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/coldze/mongol/engine/decoding"
+)
+
+func TestDecodingErrorsPointIntoFile(t *testing.T) {
+	properties := Properties{"COLLECTION": "a_much_longer_collection_name", "COUNT": "1"}
+	cases := []struct {
+		path     string
+		content  string
+		position string
+	}{
+		{"migration.json", `{"insert": "${COLLECTION}", "documents": [{"at": {"$date": "not a date"}}]}`, "migration.json:1:50:"},
+		{"migration.json", "{\"insert\": \"${COLLECTION}\",\n \"n\": ${COUNT}, \"x\": ]}", "migration.json:2:22:"},
+		{"migration.json", `{"insert": "$${COLLECTION}", "x": ]}`, "migration.json:1:35:"},
+		{"migration.mongo", `{insert: '${COLLECTION}', documents: [{_id: ObjectId()}]}`, "migration.mongo:1:54:"},
+	}
+	for _, c := range cases {
+		data, source, err := properties.Substitute(c.path, []byte(c.content))
+		if err != nil {
+			t.Fatalf("%v: failed to substitute properties: %v", c.content, err)
+		}
+		data, err = decoding.ToJSON(c.path, data)
+		if err != nil {
+			t.Fatalf("%v: failed to convert to JSON: %v", c.content, err)
+		}
+		_, err = decoding.DecodeMigration(c.path, data, source)
+		if err == nil {
+			t.Fatalf("%v: expected error", c.content)
+		}
+		if !strings.Contains(err.Error(), c.position) {
+			t.Errorf("%v: expected position %v, got: %v", c.content, c.position, err)
+		}
+	}
+}
+
+func TestSubstitute(t *testing.T) {
+	os.Setenv("MONGOL_TEST_ENV", "from-env")
+	defer os.Unsetenv("MONGOL_TEST_ENV")
+	properties := Properties{"NAME": "users", "QUOTED": `a"b'c\d`, "MONGOL_TEST_OVERRIDE": "from-properties"}
+	cases := []struct {
+		name     string
+		path     string
+		content  string
+		expected string
+		err      string
+	}{
+		{"value", "m.json", `{"insert": "${NAME}"}`, `{"insert": "users"}`, ""},
+		{"unquoted value", "m.json", `{"n": ${COUNT:5}}`, `{"n": 5}`, ""},
+		{"default", "m.json", `{"insert": "${MISSING:fallback}"}`, `{"insert": "fallback"}`, ""},
+		{"empty default", "m.json", `{"insert": "${MISSING:}"}`, `{"insert": ""}`, ""},
+		{"default is not used for defined property", "m.json", `{"insert": "${NAME:fallback}"}`, `{"insert": "users"}`, ""},
+		{"environment", "m.json", `{"insert": "${MONGOL_TEST_ENV}"}`, `{"insert": "from-env"}`, ""},
+		{"properties override environment", "m.json", `{"insert": "${MONGOL_TEST_OVERRIDE:x}"}`, `{"insert": "from-properties"}`, ""},
+		{"escaped reference", "m.json", `{"insert": "$${NAME}"}`, `{"insert": "${NAME}"}`, ""},
+		{"undefined", "m.json", `{"insert": "${MISSING}"}`, "", "Property 'MISSING' is not defined"},
+		{"unterminated", "m.json", `"insert": "${NAME"`, "", "Unterminated property reference"},
+		{"json string", "m.json", `{"insert": "${QUOTED}"}`, `{"insert": "a\"b'c\\d"}`, ""},
+		{"shell single quotes", "m.mongo", `{insert: '${QUOTED}'}`, `{insert: 'a\"b\'c\\d'}`, ""},
+		{"yaml single quotes", "m.yaml", `insert: '${QUOTED}'`, `insert: 'a"b''c\d'`, ""},
+		{"yaml plain scalar", "m.yaml", `insert: ${NAME}`, `insert: users`, ""},
+		{"json line comment", "m.json", "// ${MISSING}\n{\"insert\": \"${NAME}\"}", "// ${MISSING}\n{\"insert\": \"users\"}", ""},
+		{"json block comment", "m.json", `/* ${MISSING} */ {"insert": "${NAME}"}`, `/* ${MISSING} */ {"insert": "users"}`, ""},
+		{"shell comment", "m.mongo", "{insert: '${NAME}'} // ${MISSING}", "{insert: 'users'} // ${MISSING}", ""},
+		{"yaml comment", "m.yaml", "insert: ${NAME} # ${MISSING}\n# ${MISSING}", "insert: users # ${MISSING}\n# ${MISSING}", ""},
+	}
+	for _, c := range cases {
+		data, _, err := properties.Substitute(c.path, []byte(c.content))
+		if len(c.err) > 0 {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%v: expected error '%v', got: %v", c.name, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: failed to substitute: %v", c.name, err)
+			continue
+		}
+		if string(data) != c.expected {
+			t.Errorf("%v: expected %v, got %v", c.name, c.expected, string(data))
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package engine
+
+import (
+	"sync"
+
+	"github.com/coldze/primitives/custom_error"
+)
+
+type registeredChange struct {
+	forward  Migration
+	backward Migration
+	version  string
+}
+
+var (
+	registeredChangesLock sync.Mutex
+	registeredChanges     = map[string]*registeredChange{}
+)
+
+// RegisterChange makes change, implemented in code, available to changelogs as {"go": "<name>"}.
+// Version is stored as change's checksum, so it has to be changed along with the code.
+func RegisterChange(name string, forward Migration, backward Migration, version string) custom_error.CustomError {
+	if len(name) <= 0 {
+		return custom_error.MakeErrorf("Empty change name")
+	}
+	if forward == nil {
+		return custom_error.MakeErrorf("Empty forward migration for change '%v'", name)
+	}
+	if len(version) <= 0 {
+		return custom_error.MakeErrorf("Empty version for change '%v'", name)
+	}
+	if backward == nil {
+		backward = &DummyMigration{}
+	}
+	registeredChangesLock.Lock()
+	defer registeredChangesLock.Unlock()
+	_, ok := registeredChanges[name]
+	if ok {
+		return custom_error.MakeErrorf("Change '%v' is already registered", name)
+	}
+	registeredChanges[name] = &registeredChange{
+		forward:  forward,
+		backward: backward,
+		version:  version,
+	}
+	return nil
+}
+
+func getRegisteredChange(name string) (*registeredChange, custom_error.CustomError) {
+	registeredChangesLock.Lock()
+	defer registeredChangesLock.Unlock()
+	change, ok := registeredChanges[name]
+	if !ok {
+		return nil, custom_error.MakeErrorf("Change '%v' is not registered", name)
+	}
+	return change, nil
+}
@@ -0,0 +1,184 @@
+package engine
+
+import (
+	"github.com/coldze/mongol/engine/decoding"
+	"github.com/coldze/primitives/custom_error"
+	"github.com/coldze/primitives/logs"
+)
+
+var ddlCommands = map[string]struct{}{
+	"create":                  {},
+	"createIndexes":           {},
+	"drop":                    {},
+	"dropDatabase":            {},
+	"dropIndexes":             {},
+	"renameCollection":        {},
+	"collMod":                 {},
+	"convertToCapped":         {},
+	"cloneCollectionAsCapped": {},
+	"reIndex":                 {},
+	"compact":                 {},
+	"shardCollection":         {},
+	"eval":                    {},
+}
+
+type commandNameCollector struct {
+	names []string
+}
+
+func (c *commandNameCollector) Apply(value interface{}) custom_error.CustomError {
+	name, err := decoding.GetCommandName(value)
+	if err != nil {
+		return custom_error.NewErrorf(err, "Failed to get command name")
+	}
+	c.names = append(c.names, name)
+	return nil
+}
+
+// SessionTransaction collects changes of change set and applies them in a single server transaction on commit.
+type SessionTransaction struct {
+	log                     logs.Logger
+	changeID                string
+	changes                 []*Change
+	runInSession            SessionRunner
+	createTransactionRecord TransactionRecordFactory
+	getMigrationToApply     MigrationExtractor
+}
+
+func (t *SessionTransaction) applyChanges(applier DocumentApplier) custom_error.CustomError {
+	for _, change := range t.changes {
+		t.log.Infof("Applying change in transaction: %v.", change.ID)
+		err := t.getMigrationToApply(change).Apply(applier)
+		if err != nil {
+			return custom_error.NewErrorf(err, "Failed to apply change '%v'.", change.ID)
+		}
+		appliedMigrationRecord, err := t.createTransactionRecord(change)
+		if err != nil {
+			return custom_error.NewErrorf(err, "Failed to create transaction record. Change set ID: %v. Hash: %v. Change ID: %v", t.changeID, change.Hash, change.ID)
+		}
+		err = applier.Apply(appliedMigrationRecord)
+		if err != nil {
+			return custom_error.NewErrorf(err, "Failed to save migration record. Change set ID: %v. Hash: %v. Change ID: %v", t.changeID, change.Hash, change.ID)
+		}
+	}
+	return nil
+}
+
+func (t *SessionTransaction) Commit() custom_error.CustomError {
+	if len(t.changes) <= 0 {
+		t.log.Infof("Transaction commit. Nothing applied.")
+		return nil
+	}
+	t.log.Infof("Transaction commit")
+	err := t.runInSession(t.applyChanges)
+	t.changes = nil
+	if err != nil {
+		return custom_error.NewErrorf(err, "Failed to apply change set '%v' in transaction.", t.changeID)
+	}
+	return nil
+}
+
+func (t *SessionTransaction) Apply(change *Change) custom_error.CustomError {
+	t.log.Infof("Adding change to transaction: %v.", change.ID)
+	t.changes = append(t.changes, change)
+	return nil
+}
+
+// Rollback drops collected changes. Transaction, that failed to commit, is already aborted by session runner.
+func (t *SessionTransaction) Rollback() custom_error.CustomError {
+	t.log.Infof("Transaction rollback")
+	t.changes = nil
+	return nil
+}
+
+func newSessionTransactionFactory(runInSession SessionRunner, transactionRecFactory TransactionRecordFactory, getMigrationToApply MigrationExtractor, log logs.Logger) TransactionFactory {
+	return func(changeSet *ChangeSet) (Transaction, custom_error.CustomError) {
+		return &SessionTransaction{
+			log:                     log,
+			changeID:                changeSet.ID,
+			changes:                 []*Change{},
+			runInSession:            runInSession,
+			createTransactionRecord: transactionRecFactory,
+			getMigrationToApply:     getMigrationToApply,
+		}, nil
+	}
+}
+
+func findDDLCommand(changeSet *ChangeSet, getMigrationToApply MigrationExtractor) (string, custom_error.CustomError) {
+	collector := &commandNameCollector{}
+	for i := range changeSet.Changes {
+		err := getMigrationToApply(changeSet.Changes[i]).Apply(collector)
+		if err != nil {
+			return "", custom_error.NewErrorf(err, "Failed to collect commands of change '%v'", changeSet.Changes[i].ID)
+		}
+	}
+	for _, name := range collector.names {
+		_, ok := ddlCommands[name]
+		if ok {
+			return name, nil
+		}
+	}
+	return "", nil
+}
+
+func shouldUseSession(changeSet *ChangeSet, sessionsSupported bool, getMigrationToApply MigrationExtractor, log logs.Logger) (bool, custom_error.CustomError) {
+	if changeSet.Transactional != nil && !*changeSet.Transactional {
+		return false, nil
+	}
+	ddlCommand, err := findDDLCommand(changeSet, getMigrationToApply)
+	if err != nil {
+		return false, custom_error.NewErrorf(err, "Failed to check commands of change set '%v'", changeSet.ID)
+	}
+	if changeSet.Transactional == nil {
+		if !sessionsSupported {
+			return false, nil
+		}
+		if len(ddlCommand) > 0 {
+			log.Infof("Change set '%v' contains DDL command '%v'. Falling back to simulated transaction.", changeSet.ID, ddlCommand)
+			return false, nil
+		}
+		return true, nil
+	}
+	if !sessionsSupported {
+		return false, custom_error.MakeErrorf("Change set '%v' requires transaction, but server doesn't support transactions", changeSet.ID)
+	}
+	if len(ddlCommand) > 0 {
+		return false, custom_error.MakeErrorf("Change set '%v' requires transaction, but contains DDL command '%v'", changeSet.ID, ddlCommand)
+	}
+	return true, nil
+}
+
+func newSelectingTransactionFactory(sessionFactory TransactionFactory, simulatedFactory TransactionFactory, sessionsSupported bool, getMigrationToApply MigrationExtractor, log logs.Logger) TransactionFactory {
+	return func(changeSet *ChangeSet) (Transaction, custom_error.CustomError) {
+		useSession, err := shouldUseSession(changeSet, sessionsSupported, getMigrationToApply, log)
+		if err != nil {
+			return nil, custom_error.NewErrorf(err, "Failed to select transaction type")
+		}
+		if useSession {
+			return sessionFactory(changeSet)
+		}
+		return simulatedFactory(changeSet)
+	}
+}
+
+func NewTransactionFactory(dbChanger DocumentApplier, runInSession SessionRunner, transactionRecFactory TransactionRecordFactory, revertRecFactory TransactionRecordFactory, journalRecFactory JournalRecordFactory, appliedChanges map[string]struct{}, maxChanges int64, log logs.Logger) (TransactionFactory, custom_error.CustomError) {
+	transactionWrapper, err := newWrappedTransaction(appliedChanges, maxChanges, log)
+	if err != nil {
+		return nil, custom_error.NewErrorf(err, "Failed to create transaction wrap")
+	}
+	simulated := newSimulatedTransactionFactory(dbChanger, transactionRecFactory, revertRecFactory, journalRecFactory, getForwardMigration, getBackwardMigration, log)
+	withSession := newSessionTransactionFactory(runInSession, transactionRecFactory, getForwardMigration, log)
+	selecting := newSelectingTransactionFactory(withSession, simulated, runInSession != nil, getForwardMigration, log)
+	return wrapTransactionFactory(selecting, transactionWrapper), nil
+}
+
+func NewRollbackTransactionFactory(dbChanger DocumentApplier, runInSession SessionRunner, transactionRecFactory TransactionRecordFactory, revertRecFactory TransactionRecordFactory, journalRecFactory JournalRecordFactory, appliedChanges map[string]struct{}, maxChanges int64, log logs.Logger) (TransactionFactory, custom_error.CustomError) {
+	transactionWrapper, err := newWrappedTransaction(appliedChanges, maxChanges, log)
+	if err != nil {
+		return nil, custom_error.NewErrorf(err, "Failed to create transaction wrap")
+	}
+	simulated := newSimulatedTransactionFactory(dbChanger, transactionRecFactory, revertRecFactory, journalRecFactory, getBackwardMigration, getForwardMigration, log)
+	withSession := newSessionTransactionFactory(runInSession, transactionRecFactory, getBackwardMigration, log)
+	selecting := newSelectingTransactionFactory(withSession, simulated, runInSession != nil, getBackwardMigration, log)
+	return wrapTransactionFactory(selecting, transactionWrapper), nil
+}
@@ -0,0 +1,48 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coldze/primitives/custom_error"
+	"github.com/coldze/primitives/logs"
+)
+
+func TestSessionTransactionRunsWholeChangeSetOnRetry(t *testing.T) {
+	applier := &recordingApplier{}
+	runs := 0
+	runInSession := func(body func(applier DocumentApplier) custom_error.CustomError) custom_error.CustomError {
+		for runs < 2 {
+			runs++
+			err := body(applier)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	factory := newSessionTransactionFactory(runInSession, NewTransactionRecordFactory(testLogCollection, ""), getForwardMigration, logs.NewStdLogger())
+	changeSet := &ChangeSet{ID: "set", Changes: []*Change{newTestChange("first", "first"), newTestChange("second", "second")}}
+	transaction, err := factory(changeSet)
+	if err != nil {
+		t.Fatalf("Failed to start transaction: %v", err)
+	}
+	for _, change := range changeSet.Changes {
+		err = transaction.Apply(change)
+		if err != nil {
+			t.Fatalf("Failed to apply change: %v", err)
+		}
+	}
+	if len(applier.applied) > 0 {
+		t.Fatalf("Changes are applied before commit: %v", applier.applied)
+	}
+	err = transaction.Commit()
+	if err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	run := []string{"insert first", "update first EXECUTED", "insert second", "update second EXECUTED"}
+	expected := append(append([]string{}, run...), run...)
+	if !reflect.DeepEqual(applier.applied, expected) {
+		t.Errorf("Expected %v, got %v", expected, applier.applied)
+	}
+}
@@ -1,6 +1,8 @@
 package engine
 
 import (
+	"fmt"
+
 	"github.com/coldze/primitives/custom_error"
 	"github.com/coldze/primitives/logs"
 )
@@ -108,16 +110,36 @@ func (t *appliedCheckingTransaction) Rollback() custom_error.CustomError {
 	return nil
 }
 
+// appliedChange is a change, applied by simulated transaction, and migration, that reverts it.
+type appliedChange struct {
+	change   *Change
+	rollback Migration
+}
+
 type SimulatedTransaction struct {
 	log                     logs.Logger
 	dbChanger               DocumentApplier
-	rollbacks               []Migration
+	applied                 []appliedChange
 	changeID                string
 	createTransactionRecord TransactionRecordFactory
+	createRevertRecord      TransactionRecordFactory
+	createJournalRecord     JournalRecordFactory
 	getMigrationToApply     MigrationExtractor
 	getRollbackMigration    MigrationExtractor
 }
 
+func (t *SimulatedTransaction) mark(change *Change, state string, reason string) custom_error.CustomError {
+	journalRecord, err := t.createJournalRecord(change, state, reason)
+	if err != nil {
+		return err
+	}
+	err = t.dbChanger.Apply(journalRecord)
+	if err != nil {
+		return custom_error.NewErrorf(err, "Failed to save journal record. Change set ID: %v. Change ID: %v. State: %v", t.changeID, change.ID, state)
+	}
+	return nil
+}
+
 func (t *SimulatedTransaction) Commit() custom_error.CustomError {
 	/*transactionRecord, err := t.createTransactionRecord(t.changeID, t.hashValue)
 	if err != nil {
@@ -134,34 +156,52 @@ func (t *SimulatedTransaction) Commit() custom_error.CustomError {
 func (t *SimulatedTransaction) Apply(change *Change) custom_error.CustomError {
 	t.log.Infof("Applying change: %v.", change.ID)
 
-	err := t.getMigrationToApply(change).Apply(t.dbChanger)
+	err := t.mark(change, JOURNAL_STATE_IN_PROGRESS, "")
 	if err != nil {
 		return err
 	}
 
-	/*** Into Migration.Apply ***/
-	appliedMigrationRecord, err := t.createTransactionRecord(change.ID, change.Hash)
+	err = t.getMigrationToApply(change).Apply(t.dbChanger)
+	if err != nil {
+		markErr := t.mark(change, JOURNAL_STATE_FAILED, fmt.Sprintf("%v", err))
+		if markErr != nil {
+			t.log.Errorf("Failed to mark change '%v' as failed. Error: %v", change.ID, markErr)
+		}
+		return err
+	}
+
+	appliedMigrationRecord, err := t.createTransactionRecord(change)
 	if err != nil {
 		return custom_error.NewErrorf(err, "Failed to create transaction record. Change ID: %v. Hash: %v. Change ID: %v", t.changeID, change.Hash, change.ID)
 	}
-	t.dbChanger.Apply(appliedMigrationRecord)
+	err = t.dbChanger.Apply(appliedMigrationRecord)
 	if err != nil {
 		return custom_error.NewErrorf(err, "Failed to save migration record. Change ID: %v. Hash: %v. Change ID: %v", t.changeID, change.Hash, change.ID)
 	}
-	/*** Into Migration.Apply ^^^^^ ***/
 
-	t.rollbacks = append(t.rollbacks, t.getRollbackMigration(change))
+	t.applied = append(t.applied, appliedChange{change: change, rollback: t.getRollbackMigration(change)})
 	return nil
 }
 
+// Rollback reverts applied changes together with their records in migrations log, so log matches database afterwards.
 func (t *SimulatedTransaction) Rollback() custom_error.CustomError {
 	t.log.Infof("Transaction rollback")
-	for i := len(t.rollbacks) - 1; i >= 0; i-- {
-		err := t.rollbacks[i].Apply(t.dbChanger)
+	for i := len(t.applied) - 1; i >= 0; i-- {
+		change := t.applied[i].change
+		err := t.applied[i].rollback.Apply(t.dbChanger)
 		if err != nil {
-			return custom_error.MakeErrorf("Failed to rollback. Error: %v", err)
+			return custom_error.MakeErrorf("Failed to rollback change '%v'. Error: %v", change.ID, err)
+		}
+		revertRecord, err := t.createRevertRecord(change)
+		if err != nil {
+			return custom_error.NewErrorf(err, "Failed to create revert record. Change set ID: %v. Change ID: %v", t.changeID, change.ID)
+		}
+		err = t.dbChanger.Apply(revertRecord)
+		if err != nil {
+			return custom_error.NewErrorf(err, "Failed to save revert record. Change set ID: %v. Change ID: %v", t.changeID, change.ID)
 		}
 	}
+	t.applied = nil
 	return nil
 }
 
@@ -198,40 +238,46 @@ func newWrappedTransaction(appliedChanges map[string]struct{}, maxChanges int64,
 	}, nil
 }
 
-func NewSimulatedTransactionFactory(dbChanger DocumentApplier, transactionRecFactory TransactionRecordFactory, appliedChanges map[string]struct{}, maxChanges int64, log logs.Logger) (TransactionFactory, custom_error.CustomError) {
-	transactionWrapper, err := newWrappedTransaction(appliedChanges, maxChanges, log)
-	if err != nil {
-		return nil, custom_error.NewErrorf(err, "Failed to create transaction wrap")
-	}
-	return func(changeID string) (Transaction, custom_error.CustomError) {
-		simTransaction := &SimulatedTransaction{
-			changeID:                changeID,
+func newSimulatedTransactionFactory(dbChanger DocumentApplier, transactionRecFactory TransactionRecordFactory, revertRecFactory TransactionRecordFactory, journalRecFactory JournalRecordFactory, getMigrationToApply MigrationExtractor, getRollbackMigration MigrationExtractor, log logs.Logger) TransactionFactory {
+	return func(changeSet *ChangeSet) (Transaction, custom_error.CustomError) {
+		return &SimulatedTransaction{
+			changeID:                changeSet.ID,
 			log:                     log,
 			dbChanger:               dbChanger,
-			rollbacks:               []Migration{},
+			applied:                 []appliedChange{},
 			createTransactionRecord: transactionRecFactory,
-			getMigrationToApply:     getForwardMigration,
-			getRollbackMigration:    getBackwardMigration,
+			createRevertRecord:      revertRecFactory,
+			createJournalRecord:     journalRecFactory,
+			getMigrationToApply:     getMigrationToApply,
+			getRollbackMigration:    getRollbackMigration,
+		}, nil
+	}
+}
+
+func wrapTransactionFactory(factory TransactionFactory, transactionWrapper func(Transaction) Transaction) TransactionFactory {
+	return func(changeSet *ChangeSet) (Transaction, custom_error.CustomError) {
+		transaction, err := factory(changeSet)
+		if err != nil {
+			return nil, err
 		}
-		return transactionWrapper(simTransaction), nil
-	}, nil
+		return transactionWrapper(transaction), nil
+	}
 }
 
-func NewRollbackSimulatedTransactionFactory(dbChanger DocumentApplier, transactionRecFactory TransactionRecordFactory, appliedChanges map[string]struct{}, maxChanges int64, log logs.Logger) (TransactionFactory, custom_error.CustomError) {
+func NewSimulatedTransactionFactory(dbChanger DocumentApplier, transactionRecFactory TransactionRecordFactory, revertRecFactory TransactionRecordFactory, journalRecFactory JournalRecordFactory, appliedChanges map[string]struct{}, maxChanges int64, log logs.Logger) (TransactionFactory, custom_error.CustomError) {
 	transactionWrapper, err := newWrappedTransaction(appliedChanges, maxChanges, log)
 	if err != nil {
 		return nil, custom_error.NewErrorf(err, "Failed to create transaction wrap")
 	}
-	return func(changeID string) (Transaction, custom_error.CustomError) {
-		simTransaction := &SimulatedTransaction{
-			changeID:                changeID,
-			log:                     log,
-			dbChanger:               dbChanger,
-			rollbacks:               []Migration{},
-			createTransactionRecord: transactionRecFactory,
-			getMigrationToApply:     getBackwardMigration,
-			getRollbackMigration:    getForwardMigration,
-		}
-		return transactionWrapper(simTransaction), nil
-	}, nil
+	simulated := newSimulatedTransactionFactory(dbChanger, transactionRecFactory, revertRecFactory, journalRecFactory, getForwardMigration, getBackwardMigration, log)
+	return wrapTransactionFactory(simulated, transactionWrapper), nil
+}
+
+func NewRollbackSimulatedTransactionFactory(dbChanger DocumentApplier, transactionRecFactory TransactionRecordFactory, revertRecFactory TransactionRecordFactory, journalRecFactory JournalRecordFactory, appliedChanges map[string]struct{}, maxChanges int64, log logs.Logger) (TransactionFactory, custom_error.CustomError) {
+	transactionWrapper, err := newWrappedTransaction(appliedChanges, maxChanges, log)
+	if err != nil {
+		return nil, custom_error.NewErrorf(err, "Failed to create transaction wrap")
+	}
+	simulated := newSimulatedTransactionFactory(dbChanger, transactionRecFactory, revertRecFactory, journalRecFactory, getBackwardMigration, getForwardMigration, log)
+	return wrapTransactionFactory(simulated, transactionWrapper), nil
 }
@@ -0,0 +1,135 @@
+package engine
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/coldze/primitives/custom_error"
+	"github.com/coldze/primitives/logs"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const testLogCollection = "log"
+
+// recordingApplier remembers applied commands and fails on commands for failOn collection.
+type recordingApplier struct {
+	failOn  string
+	applied []string
+}
+
+func lookupTestValue(doc primitive.D, keys ...string) interface{} {
+	var value interface{} = doc
+	for _, key := range keys {
+		current, ok := value.(primitive.D)
+		if !ok {
+			return nil
+		}
+		value = nil
+		for _, element := range current {
+			if element.Key == key {
+				value = element.Value
+			}
+		}
+	}
+	return value
+}
+
+// describeCommand shortens commands to "<command> <collection>" and records of migrations log to "<command> <change id> <state>".
+func describeCommand(value interface{}) string {
+	doc := value.(primitive.D)
+	if doc[0].Value != testLogCollection {
+		return fmt.Sprintf("%v %v", doc[0].Key, doc[0].Value)
+	}
+	switch doc[0].Key {
+	case "update":
+		update := lookupTestValue(doc, "updates").(primitive.A)[0].(primitive.D)
+		return fmt.Sprintf("update %v %v", lookupTestValue(update, "q", "change_id"), lookupTestValue(update, "u", "$set", "state"))
+	case "delete":
+		del := lookupTestValue(doc, "deletes").(primitive.A)[0].(primitive.D)
+		return fmt.Sprintf("delete %v", lookupTestValue(del, "q", "change_id"))
+	}
+	return doc[0].Key
+}
+
+func (r *recordingApplier) Apply(value interface{}) custom_error.CustomError {
+	description := describeCommand(value)
+	r.applied = append(r.applied, description)
+	if description == "insert "+r.failOn {
+		return custom_error.MakeErrorf("Failed to insert into '%v'", r.failOn)
+	}
+	return nil
+}
+
+func newTestChange(id string, collection string) *Change {
+	return &Change{
+		ID:       id,
+		Hash:     "hash-" + id,
+		Forward:  &SimpleMigration{commands: []interface{}{primitive.D{{Key: "insert", Value: collection}}}},
+		Backward: &SimpleMigration{commands: []interface{}{primitive.D{{Key: "drop", Value: collection}}}},
+	}
+}
+
+func TestSimulatedTransactionRollbackRevertsRecords(t *testing.T) {
+	cases := []struct {
+		name     string
+		factory  func(applier DocumentApplier) (TransactionFactory, custom_error.CustomError)
+		failOn   string
+		expected []string
+	}{
+		{
+			name: "migrate",
+			factory: func(applier DocumentApplier) (TransactionFactory, custom_error.CustomError) {
+				return NewSimulatedTransactionFactory(applier, NewTransactionRecordFactory(testLogCollection, ""), NewRollbackTransactionRecordFactory(testLogCollection),
+					NewJournalRecordFactory(testLogCollection, JOURNAL_OPERATION_MIGRATE), map[string]struct{}{}, -1, logs.NewStdLogger())
+			},
+			failOn: "second",
+			expected: []string{
+				"update first IN_PROGRESS", "insert first", "update first EXECUTED",
+				"update second IN_PROGRESS", "insert second", "update second FAILED",
+				"drop first", "delete first",
+			},
+		},
+		{
+			name: "rollback",
+			factory: func(applier DocumentApplier) (TransactionFactory, custom_error.CustomError) {
+				return NewRollbackSimulatedTransactionFactory(applier, NewRollbackTransactionRecordFactory(testLogCollection), NewTransactionRecordFactory(testLogCollection, ""),
+					NewJournalRecordFactory(testLogCollection, JOURNAL_OPERATION_ROLLBACK), map[string]struct{}{}, -1, logs.NewStdLogger())
+			},
+			failOn: "",
+			expected: []string{
+				"update first IN_PROGRESS", "drop first", "delete first",
+				"update second IN_PROGRESS", "drop second", "delete second",
+				"insert second", "update second EXECUTED", "insert first", "update first EXECUTED",
+			},
+		},
+	}
+	for _, c := range cases {
+		applier := &recordingApplier{failOn: c.failOn}
+		factory, err := c.factory(applier)
+		if err != nil {
+			t.Fatalf("%v: failed to create factory: %v", c.name, err)
+		}
+		changeSet := &ChangeSet{ID: "set", Changes: []*Change{newTestChange("first", "first"), newTestChange("second", "second")}}
+		transaction, err := factory(changeSet)
+		if err != nil {
+			t.Fatalf("%v: failed to start transaction: %v", c.name, err)
+		}
+		for _, change := range changeSet.Changes {
+			err = transaction.Apply(change)
+			if err != nil {
+				break
+			}
+		}
+		if c.failOn != "" && err == nil {
+			t.Fatalf("%v: expected change to fail", c.name)
+		}
+		err = transaction.Rollback()
+		if err != nil {
+			t.Fatalf("%v: failed to rollback: %v", c.name, err)
+		}
+		if !reflect.DeepEqual(applier.applied, c.expected) {
+			t.Errorf("%v: unexpected commands.\nExpected: %v\nGot:      %v", c.name, c.expected, applier.applied)
+		}
+	}
+}
@@ -10,4 +10,8 @@ type Transaction interface {
 	Rollback() custom_error.CustomError
 }
 
-type TransactionFactory func(changeID string) (Transaction, custom_error.CustomError)
+type TransactionFactory func(changeSet *ChangeSet) (Transaction, custom_error.CustomError)
+
+// SessionRunner runs body inside of server transaction and commits it. Body is run again, when transaction fails with
+// transient error, so it must not keep state between runs. Applier is valid only inside of body.
+type SessionRunner func(body func(applier DocumentApplier) custom_error.CustomError) custom_error.CustomError
@@ -1,7 +1,9 @@
 package engine
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/coldze/mongol/engine/decoding"
@@ -10,31 +12,75 @@ import (
 
 const (
 	COLLECTION_NAME_MIGRATIONS_LOG   = "mongol_migrations_3710611845fe4161b74d2ec5eafe9124"
-	transaction_add_record_format    = "{\"insert\": \"%s\", \"documents\":[{\"change_id\": \"%%s\", \"hash\":\"%%s\", \"applied_at_utc\": %%d }]}"
-	transaction_remove_record_format = "{\"delete\": \"%s\", \"deletes\": [{\"q\": {\"change_id\": \"%%s\"}, \"limit\": 1}]}"
+	transaction_add_record_format    = "{\"update\": %s, \"updates\": [{\"q\": {\"change_id\": %%s}, \"u\": {\"$set\": {\"change_id\": %%s, \"hash\": %%s, \"author\": %%s, \"contexts\": %%s, \"state\": %%s, \"last_applied_at_utc\": %%d }, \"$min\": {\"applied_at_utc\": %%d }, \"$unset\": {\"error\": \"\", \"pending_hash\": \"\"}}, \"upsert\": true}]}"
+	transaction_remove_record_format = "{\"delete\": %s, \"deletes\": [{\"q\": {\"change_id\": %%s}, \"limit\": 1}]}"
+	journal_record_format            = "{\"update\": %s, \"updates\": [{\"q\": {\"change_id\": %%s}, \"u\": {\"$set\": {\"pending_hash\": %%s, \"state\": %%s, \"operation\": %%s, \"error\": %%s, \"updated_at_utc\": %%d }, \"$setOnInsert\": {\"change_id\": %%s, \"hash\": %%s, \"author\": %%s}}, \"upsert\": true}]}"
 )
 
-type TransactionRecordFactory func(changeID string, hashValue string) (interface{}, custom_error.CustomError)
+const (
+	JOURNAL_STATE_IN_PROGRESS = "IN_PROGRESS"
+	JOURNAL_STATE_EXECUTED    = "EXECUTED"
+	JOURNAL_STATE_FAILED      = "FAILED"
+	JOURNAL_STATE_MARK_RAN    = "MARK_RAN"
+
+	JOURNAL_OPERATION_MIGRATE  = "migrate"
+	JOURNAL_OPERATION_ROLLBACK = "rollback"
+)
+
+type TransactionRecordFactory func(change *Change) (interface{}, custom_error.CustomError)
+
+// JournalRecordFactory builds command, that marks change in migrations log with state of unfinished operation. Checksum
+// and time of previous application are kept, new checksum is stored as pending_hash, until change succeeds.
+type JournalRecordFactory func(change *Change, state string, reason string) (interface{}, custom_error.CustomError)
+
+func quote(value string) string {
+	quoted, err := json.Marshal(value)
+	if err != nil {
+		return "\"\""
+	}
+	return string(quoted)
+}
 
-func NewTransactionRecordFactory(collectionName string) TransactionRecordFactory {
-	format := fmt.Sprintf(transaction_add_record_format, collectionName)
-	return func(changeID string, hashValue string) (interface{}, custom_error.CustomError) {
-		data := fmt.Sprintf(format, changeID, hashValue, time.Now().UnixNano())
+// NewTransactionRecordFactory records applied change with contexts expression of the run, that applied it. Time of the
+// first application is kept with $min, since record can already exist: it's created by journal record or left from
+// previous application of runAlways/runOnChange change.
+func NewTransactionRecordFactory(collectionName string, contexts string) TransactionRecordFactory {
+	contexts = strings.TrimSpace(contexts)
+	format := fmt.Sprintf(transaction_add_record_format, quote(collectionName))
+	return func(change *Change) (interface{}, custom_error.CustomError) {
+		state := JOURNAL_STATE_EXECUTED
+		if change.MarkRan {
+			state = JOURNAL_STATE_MARK_RAN
+		}
+		now := time.Now().UnixNano()
+		data := fmt.Sprintf(format, quote(change.ID), quote(change.ID), quote(change.Hash), quote(change.Author), quote(contexts), quote(state), now, now)
 		v, err := decoding.DecodeExt([]byte(data))
 		if err != nil {
-			return nil, custom_error.NewErrorf(err, "Failed to create transaction record. ChangeID: %v. Hash: %v", changeID, hashValue)
+			return nil, custom_error.NewErrorf(err, "Failed to create transaction record. ChangeID: %v. Hash: %v", change.ID, change.Hash)
 		}
 		return v, nil
 	}
 }
 
 func NewRollbackTransactionRecordFactory(collectionName string) TransactionRecordFactory {
-	format := fmt.Sprintf(transaction_remove_record_format, collectionName)
-	return func(changeID string, hashValue string) (interface{}, custom_error.CustomError) {
-		data := fmt.Sprintf(format, changeID)
+	format := fmt.Sprintf(transaction_remove_record_format, quote(collectionName))
+	return func(change *Change) (interface{}, custom_error.CustomError) {
+		data := fmt.Sprintf(format, quote(change.ID))
+		v, err := decoding.DecodeExt([]byte(data))
+		if err != nil {
+			return nil, custom_error.NewErrorf(err, "Failed to create transaction record. ChangeID: %v. Hash: %v", change.ID, change.Hash)
+		}
+		return v, nil
+	}
+}
+
+func NewJournalRecordFactory(collectionName string, operation string) JournalRecordFactory {
+	format := fmt.Sprintf(journal_record_format, quote(collectionName))
+	return func(change *Change, state string, reason string) (interface{}, custom_error.CustomError) {
+		data := fmt.Sprintf(format, quote(change.ID), quote(change.Hash), quote(state), quote(operation), quote(reason), time.Now().UnixNano(), quote(change.ID), quote(change.Hash), quote(change.Author))
 		v, err := decoding.DecodeExt([]byte(data))
 		if err != nil {
-			return nil, custom_error.NewErrorf(err, "Failed to create transaction record. ChangeID: %v. Hash: %v", changeID, hashValue)
+			return nil, custom_error.NewErrorf(err, "Failed to create journal record. ChangeID: %v. State: %v", change.ID, state)
 		}
 		return v, nil
 	}
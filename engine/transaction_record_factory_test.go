@@ -0,0 +1,57 @@
+package engine
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRecordsKeepPreviousApplication(t *testing.T) {
+	change := newTestChange("first", "first")
+	add, err := NewTransactionRecordFactory(testLogCollection, "")(change)
+	if err != nil {
+		t.Fatalf("Failed to create transaction record: %v", err)
+	}
+	runAdd, err := NewTransactionRecordFactory(testLogCollection, " dev and !perf ")(change)
+	if err != nil {
+		t.Fatalf("Failed to create transaction record: %v", err)
+	}
+	journal, err := NewJournalRecordFactory(testLogCollection, JOURNAL_OPERATION_MIGRATE)(change, JOURNAL_STATE_IN_PROGRESS, "")
+	if err != nil {
+		t.Fatalf("Failed to create journal record: %v", err)
+	}
+	cases := []struct {
+		name     string
+		record   interface{}
+		path     []string
+		expected interface{}
+	}{
+		{"first application time", add, []string{"$min", "applied_at_utc"}, nil},
+		{"last application time", add, []string{"$set", "last_applied_at_utc"}, nil},
+		{"no application time overwrite", add, []string{"$set", "applied_at_utc"}, "missing"},
+		{"contexts of the run", runAdd, []string{"$set", "contexts"}, "dev and !perf"},
+		{"no contexts of the run", add, []string{"$set", "contexts"}, ""},
+		{"no labels of change set", runAdd, []string{"$set", "labels"}, "missing"},
+		{"pending checksum", journal, []string{"$set", "pending_hash"}, change.Hash},
+		{"checksum of new record", journal, []string{"$setOnInsert", "hash"}, change.Hash},
+		{"no checksum overwrite", journal, []string{"$set", "hash"}, "missing"},
+	}
+	for _, c := range cases {
+		update := lookupTestValue(c.record.(primitive.D), "updates").(primitive.A)[0].(primitive.D)
+		value := lookupTestValue(update, append([]string{"u"}, c.path...)...)
+		switch c.expected {
+		case nil:
+			if value == nil {
+				t.Errorf("%v: %v is not set", c.name, c.path)
+			}
+		case "missing":
+			if value != nil {
+				t.Errorf("%v: %v is set to %v", c.name, c.path, value)
+			}
+		default:
+			if value != c.expected {
+				t.Errorf("%v: expected %v = %v, got %v", c.name, c.path, c.expected, value)
+			}
+		}
+	}
+}
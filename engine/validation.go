@@ -0,0 +1,122 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/coldze/mongol/engine/decoding"
+	"github.com/coldze/primitives/custom_error"
+)
+
+var knownCommands = map[string]struct{}{
+	"insert":                   {},
+	"update":                   {},
+	"delete":                   {},
+	"find":                     {},
+	"findAndModify":            {},
+	"aggregate":                {},
+	"count":                    {},
+	"distinct":                 {},
+	"listCollections":          {},
+	"listIndexes":              {},
+	"validate":                 {},
+	"applyOps":                 {},
+	"createUser":               {},
+	"updateUser":               {},
+	"dropUser":                 {},
+	"grantRolesToUser":         {},
+	"revokeRolesFromUser":      {},
+	"createRole":               {},
+	"updateRole":               {},
+	"dropRole":                 {},
+	"grantPrivilegesToRole":    {},
+	"revokePrivilegesFromRole": {},
+	"grantRolesToRole":         {},
+	"revokeRolesFromRole":      {},
+	"enableSharding":           {},
+	"goMigration":              {},
+}
+
+type ValidationIssue struct {
+	Path    string
+	Message string
+	Warning bool
+}
+
+func (v *ValidationIssue) String() string {
+	level := "ERROR"
+	if v.Warning {
+		level = "WARNING"
+	}
+	return fmt.Sprintf("%v %v: %v", level, v.Path, v.Message)
+}
+
+type changeLogValidator struct {
+	issues []*ValidationIssue
+}
+
+func (v *changeLogValidator) fail(path string, format string, args ...interface{}) {
+	v.issues = append(v.issues, &ValidationIssue{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *changeLogValidator) warn(path string, format string, args ...interface{}) {
+	v.issues = append(v.issues, &ValidationIssue{Path: path, Message: fmt.Sprintf(format, args...), Warning: true})
+}
+
+func isKnownCommand(name string) bool {
+	_, ok := knownCommands[name]
+	if ok {
+		return true
+	}
+	_, ok = ddlCommands[name]
+	return ok
+}
+
+func (v *changeLogValidator) checkCommands(path string, changeID string, direction string, migration Migration) int {
+	collector := &commandCollector{}
+	err := migration.Apply(collector)
+	if err != nil {
+		v.fail(path, "Change '%v' has invalid %v migration: %v", changeID, direction, err)
+		return 0
+	}
+	for i := range collector.commands {
+		name, err := decoding.GetCommandName(collector.commands[i])
+		if err != nil {
+			v.fail(path, "Change '%v' has invalid %v command #%v: %v", changeID, direction, i+1, err)
+			continue
+		}
+		if !isKnownCommand(name) {
+			v.fail(path, "Change '%v' has unknown %v command '%v'", changeID, direction, name)
+		}
+	}
+	return len(collector.commands)
+}
+
+func (v *changeLogValidator) onError(path string, err custom_error.CustomError) custom_error.CustomError {
+	v.fail(path, "%v", err)
+	return nil
+}
+
+func (v *changeLogValidator) onChange(path string, changeFile *ChangeFile, change *Change) {
+	v.checkCommands(path, change.ID, "forward", change.Forward)
+	if v.checkCommands(path, change.ID, "rollback", change.Backward) <= 0 && len(changeFile.Go) <= 0 {
+		v.warn(path, "Change '%v' has empty rollback", change.ID)
+	}
+}
+
+// ValidateChangeLog loads changelog tree the same way, as NewChangeLog does, without connecting to database
+// and reports every problem found, instead of stopping at the first one.
+func ValidateChangeLog(path string, properties Properties) []*ValidationIssue {
+	validator := &changeLogValidator{
+		issues: []*ValidationIssue{},
+	}
+	changeLog, err := readMainChangeLog(path, forwardStrategy, properties)
+	if err != nil {
+		validator.fail(path, "%v", err)
+		return validator.issues
+	}
+	err = changeLog.validate(validator)
+	if err != nil {
+		validator.fail(path, "%v", err)
+	}
+	return validator.issues
+}
@@ -0,0 +1,112 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const validationTestChangeLog = `{"connection": "mongodb://localhost:27017", "dbname": "mongol", "migrations": [{"includeAll": "sets", "pattern": "*.json"}]}`
+
+func TestValidateChangeLog(t *testing.T) {
+	cases := []struct {
+		name    string
+		files   map[string]string
+		message string
+		warning bool
+		strict  bool
+	}{
+		{
+			name: "duplicated change id",
+			files: map[string]string{
+				"sets/set.json": `{"id": "set", "changes": [{"id": "a", "migration": "../insert.json"}, {"id": "a", "migration": "../insert.json"}]}`,
+				"insert.json":   `{"insert": "users", "documents": [{"_id": 1}]}`,
+			},
+			message: "Dublicated change id 'set_a'",
+			strict:  true,
+		},
+		{
+			name: "duplicated change set id",
+			files: map[string]string{
+				"sets/first.json":  `{"id": "set", "changes": [{"migration": "../insert.json"}]}`,
+				"sets/second.json": `{"id": "set", "changes": [{"migration": "../insert.json"}]}`,
+				"insert.json":      `{"insert": "users", "documents": [{"_id": 1}]}`,
+			},
+			message: "Dublicated changeset id 'set'",
+			strict:  true,
+		},
+		{
+			name: "unresolved include",
+			files: map[string]string{
+				"sets/set.json": `{"id": "set", "changes": [{"migration": "../missing.json", "rollback": []}]}`,
+			},
+			message: "Failed to read file '../missing.json'",
+			strict:  true,
+		},
+		{
+			name: "empty includeAll",
+			files: map[string]string{
+				"sets/set.yaml": `id: set`,
+			},
+			message: "No migrations in 'sets' match pattern '*.json'",
+			strict:  true,
+		},
+		{
+			name: "unknown command",
+			files: map[string]string{
+				"sets/set.json": `{"id": "set", "changes": [{"migration": "../unknown.json", "rollback": "../insert.json"}]}`,
+				"unknown.json":  `{"insertt": "users", "documents": [{"_id": 1}]}`,
+				"insert.json":   `{"insert": "users", "documents": [{"_id": 1}]}`,
+			},
+			message: "Change 'set_transaction_entry_0' has unknown forward command 'insertt'",
+		},
+		{
+			name: "empty rollback",
+			files: map[string]string{
+				"sets/set.json": `{"id": "set", "changes": [{"migration": "../insert.json", "rollback": []}]}`,
+				"insert.json":   `{"insert": "users", "documents": [{"_id": 1}]}`,
+			},
+			message: "Change 'set_transaction_entry_0' has empty rollback",
+			warning: true,
+		},
+	}
+	for _, c := range cases {
+		c.files["changelog.json"] = validationTestChangeLog
+		dir := writeTestFiles(t, c.files)
+		path := filepath.Join(dir, "changelog.json")
+		issues := ValidateChangeLog(path, Properties{})
+		if len(issues) != 1 {
+			t.Errorf("%v: expected single issue, got: %v", c.name, issues)
+		} else {
+			if !strings.Contains(issues[0].Message, c.message) {
+				t.Errorf("%v: expected issue with '%v', got: %v", c.name, c.message, issues[0])
+			}
+			if issues[0].Warning != c.warning {
+				t.Errorf("%v: expected warning: %v, got: %v", c.name, c.warning, issues[0])
+			}
+		}
+		_, err := NewChangeLog(path, Properties{})
+		if c.strict && err == nil {
+			t.Errorf("%v: expected changelog to fail on the same problem", c.name)
+		}
+		if !c.strict && err != nil {
+			t.Errorf("%v: expected changelog to load: %v", c.name, err)
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestValidateChangeLogReportsEveryProblem(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"changelog.json":   validationTestChangeLog,
+		"sets/first.json":  `{"id": "first", "changes": [{"migration": "../missing.json", "rollback": []}, {"migration": "../unknown.json", "rollback": []}]}`,
+		"sets/second.json": `{"id": "second", "changes": [{"migration": "../missing.json", "rollback": []}]}`,
+		"unknown.json":     `{"insertt": "users"}`,
+	})
+	defer os.RemoveAll(dir)
+	issues := ValidateChangeLog(filepath.Join(dir, "changelog.json"), Properties{})
+	if len(issues) != 4 {
+		t.Fatalf("Expected 4 issues, got: %v", issues)
+	}
+}
@@ -2,9 +2,14 @@ package mongo
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
 	"github.com/coldze/mongol/engine"
+	"github.com/coldze/mongol/engine/decoding"
 	"github.com/coldze/primitives/custom_error"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	mgo "go.mongodb.org/mongo-driver/mongo"
 )
 
@@ -13,18 +18,137 @@ type DbChanger struct {
 	context context.Context
 }
 
+type WriteError struct {
+	Index   int32  `bson:"index"`
+	Code    int32  `bson:"code"`
+	Message string `bson:"errmsg"`
+}
+
+func (e WriteError) String() string {
+	return fmt.Sprintf("index: %v, code: %v, message: '%v'", e.Index, e.Code, e.Message)
+}
+
+type WriteConcernError struct {
+	Code    int32  `bson:"code"`
+	Message string `bson:"errmsg"`
+}
+
+// WriteOperationsError is a reply of command, that failed as a whole (ok:0), or reported write errors or write concern error.
 type WriteOperationsError struct {
-	Errors interface{} `bson:"writeErrors,omitempty"`
+	Command           string             `bson:"-"`
+	OK                float64            `bson:"ok"`
+	Code              int32              `bson:"code,omitempty"`
+	Message           string             `bson:"errmsg,omitempty"`
+	Errors            []WriteError       `bson:"writeErrors,omitempty"`
+	WriteConcernError *WriteConcernError `bson:"writeConcernError,omitempty"`
+	Labels            []string           `bson:"errorLabels,omitempty"`
 }
 
-func (c *DbChanger) Apply(value interface{}) custom_error.CustomError {
-	res := c.db.RunCommand(c.context, value)
-	if res.Err() != nil {
-		return custom_error.MakeErrorf("Failed to apply change. Error: %v", res.Err())
+func (e *WriteOperationsError) failed() bool {
+	return e.OK == 0 || len(e.Errors) > 0 || e.WriteConcernError != nil
+}
+
+func (e *WriteOperationsError) HasErrorLabel(label string) bool {
+	for i := range e.Labels {
+		if e.Labels[i] == label {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *WriteOperationsError) Error() string {
+	parts := []string{}
+	if e.OK == 0 {
+		parts = append(parts, fmt.Sprintf("command failed (code: %v, message: '%v')", e.Code, e.Message))
+	}
+	for _, writeError := range e.Errors {
+		parts = append(parts, fmt.Sprintf("write error (%v)", writeError))
+	}
+	if e.WriteConcernError != nil {
+		parts = append(parts, fmt.Sprintf("write concern error (code: %v, message: '%v')", e.WriteConcernError.Code, e.WriteConcernError.Message))
+	}
+	return fmt.Sprintf("Command '%v': %v", e.Command, strings.Join(parts, "; "))
+}
+
+// writeOperationsFailure keeps reply of failed command, so callers can check codes and messages of write errors.
+type writeOperationsFailure struct {
+	custom_error.CustomError
+	reply *WriteOperationsError
+}
+
+func newWriteOperationsFailure(reply *WriteOperationsError) custom_error.CustomError {
+	return &writeOperationsFailure{
+		CustomError: custom_error.MakeError(reply),
+		reply:       reply,
+	}
+}
+
+// GetWriteOperationsError returns reply of failed command, if err was returned by DbChanger.
+func GetWriteOperationsError(err error) (*WriteOperationsError, bool) {
+	failure, ok := err.(*writeOperationsFailure)
+	if !ok {
+		return nil, false
+	}
+	return failure.reply, true
+}
+
+func checkReply(commandName string, data bson.Raw) custom_error.CustomError {
+	reply := &WriteOperationsError{Command: commandName}
+	err := bson.Unmarshal(data, reply)
+	if err != nil {
+		return custom_error.MakeErrorf("Failed to decode reply of command '%v'. Error: %v", commandName, err)
+	}
+	if reply.failed() {
+		return newWriteOperationsFailure(reply)
 	}
 	return nil
 }
 
+// qualifyAdminCommand runs renameCollection against admin database, resolving short collection names against migration's database.
+func (c *DbChanger) qualifyAdminCommand(value interface{}) (*mgo.Database, interface{}) {
+	command, ok := value.(primitive.D)
+	if !ok || len(command) <= 0 || command[0].Key != "renameCollection" {
+		return c.db, value
+	}
+	qualified := make(primitive.D, 0, len(command))
+	for i := range command {
+		name, ok := command[i].Value.(string)
+		if ok && (command[i].Key == "renameCollection" || command[i].Key == "to") && !strings.Contains(name, ".") {
+			qualified = append(qualified, primitive.E{Key: command[i].Key, Value: c.db.Name() + "." + name})
+			continue
+		}
+		qualified = append(qualified, command[i])
+	}
+	return c.db.Client().Database("admin"), qualified
+}
+
+func (c *DbChanger) Apply(value interface{}) custom_error.CustomError {
+	commandName, errValue := decoding.GetCommandName(value)
+	if errValue != nil {
+		commandName = "unknown"
+	}
+	db, value := c.qualifyAdminCommand(value)
+	res := db.RunCommand(c.context, value)
+	err := res.Err()
+	cmdErr, ok := err.(mgo.CommandError)
+	if ok {
+		return newWriteOperationsFailure(&WriteOperationsError{Command: commandName, Code: cmdErr.Code, Message: cmdErr.Message, Labels: cmdErr.Labels})
+	}
+	if err != nil {
+		return custom_error.MakeErrorf("Failed to apply change. Error: %v", err)
+	}
+	data, err := res.DecodeBytes()
+	if err != nil {
+		return custom_error.MakeErrorf("Failed to decode reply of command '%v'. Error: %v", commandName, err)
+	}
+	return checkReply(commandName, data)
+}
+
+func (c *DbChanger) GetDatabase() (context.Context, *mgo.Database) {
+	return c.context, c.db
+}
+
 func NewDbChanger(db *mgo.Database, context context.Context) engine.DocumentApplier {
 	dbChanger := &DbChanger{
 		context: context,
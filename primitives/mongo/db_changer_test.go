@@ -0,0 +1,72 @@
+package mongo
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestCheckReply(t *testing.T) {
+	cases := []struct {
+		name     string
+		reply    bson.D
+		expected *WriteOperationsError
+	}{
+		{
+			name:     "success",
+			reply:    bson.D{{Key: "ok", Value: 1.0}, {Key: "n", Value: int32(2)}},
+			expected: nil,
+		},
+		{
+			name: "write errors and write concern error",
+			reply: bson.D{
+				{Key: "ok", Value: 1.0},
+				{Key: "n", Value: int32(1)},
+				{Key: "writeErrors", Value: bson.A{
+					bson.D{{Key: "index", Value: int32(1)}, {Key: "code", Value: int32(11000)}, {Key: "errmsg", Value: "duplicate key"}},
+				}},
+				{Key: "writeConcernError", Value: bson.D{{Key: "code", Value: int32(64)}, {Key: "errmsg", Value: "waiting for replication timed out"}}},
+			},
+			expected: &WriteOperationsError{
+				Command:           "insert",
+				OK:                1,
+				Errors:            []WriteError{{Index: 1, Code: 11000, Message: "duplicate key"}},
+				WriteConcernError: &WriteConcernError{Code: 64, Message: "waiting for replication timed out"},
+			},
+		},
+		{
+			name:  "command failure",
+			reply: bson.D{{Key: "ok", Value: 0.0}, {Key: "code", Value: int32(251)}, {Key: "errmsg", Value: "no such transaction"}, {Key: "errorLabels", Value: bson.A{"TransientTransactionError"}}},
+			expected: &WriteOperationsError{
+				Command: "insert",
+				Code:    251,
+				Message: "no such transaction",
+				Labels:  []string{"TransientTransactionError"},
+			},
+		},
+	}
+	for _, c := range cases {
+		data, err := bson.Marshal(c.reply)
+		if err != nil {
+			t.Fatalf("%v: failed to encode reply: %v", c.name, err)
+		}
+		errValue := checkReply("insert", data)
+		if c.expected == nil {
+			if errValue != nil {
+				t.Errorf("%v: unexpected error: %v", c.name, errValue)
+			}
+			continue
+		}
+		if errValue == nil {
+			t.Fatalf("%v: expected error", c.name)
+		}
+		reply, ok := GetWriteOperationsError(errValue)
+		if !ok {
+			t.Fatalf("%v: reply can't be retrieved from error: %v", c.name, errValue)
+		}
+		if !reflect.DeepEqual(reply, c.expected) {
+			t.Errorf("%v: expected %+v, got %+v", c.name, c.expected, reply)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package mongo
+
+import (
+	"context"
+
+	"github.com/coldze/mongol/engine"
+	"github.com/coldze/primitives/custom_error"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	mgo "go.mongodb.org/mongo-driver/mongo"
+)
+
+type MigrationFunc func(ctx context.Context, db *mgo.Database) error
+
+// DatabaseApplier is implemented by document appliers, that execute commands against live database.
+type DatabaseApplier interface {
+	engine.DocumentApplier
+	GetDatabase() (context.Context, *mgo.Database)
+}
+
+// GoMigration is a change implemented in code. Register it with RegisterGoMigration
+// and reference from migration changelog as {"id": "...", "go": "<ID>"}.
+// Up and Down receive session's context, when change set runs in transaction.
+type GoMigration struct {
+	ID      string
+	Version string
+	Up      MigrationFunc
+	Down    MigrationFunc
+}
+
+type goFuncMigration struct {
+	id        string
+	direction string
+	version   string
+	run       MigrationFunc
+}
+
+func (g *goFuncMigration) Apply(visitor engine.DocumentApplier) custom_error.CustomError {
+	if g.run == nil {
+		return nil
+	}
+	dbApplier, ok := visitor.(DatabaseApplier)
+	if !ok {
+		return visitor.Apply(primitive.D{
+			{Key: "goMigration", Value: g.id},
+			{Key: "direction", Value: g.direction},
+			{Key: "version", Value: g.version},
+		})
+	}
+	ctx, db := dbApplier.GetDatabase()
+	err := g.run(ctx, db)
+	if err != nil {
+		return custom_error.MakeErrorf("Go migration '%v' (%v) failed. Error: %v", g.id, g.direction, err)
+	}
+	return nil
+}
+
+func RegisterGoMigration(migration *GoMigration) custom_error.CustomError {
+	if migration == nil {
+		return custom_error.MakeErrorf("Nil go-migration provided")
+	}
+	if migration.Up == nil {
+		return custom_error.MakeErrorf("Go migration '%v' has no Up function", migration.ID)
+	}
+	forward := &goFuncMigration{
+		id:        migration.ID,
+		direction: "up",
+		version:   migration.Version,
+		run:       migration.Up,
+	}
+	backward := &goFuncMigration{
+		id:        migration.ID,
+		direction: "down",
+		version:   migration.Version,
+		run:       migration.Down,
+	}
+	err := engine.RegisterChange(migration.ID, forward, backward, migration.Version)
+	if err != nil {
+		return custom_error.NewErrorf(err, "Failed to register go-migration")
+	}
+	return nil
+}
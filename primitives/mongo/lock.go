@@ -1,28 +1,269 @@
 package mongo
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
 	"github.com/coldze/mongol/primitives"
 	"github.com/coldze/primitives/custom_error"
+	"github.com/coldze/primitives/logs"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	mgo "go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	COLLECTION_NAME_LOCKS = "mongol_migration_lock"
+	migrationLockID       = "migration_lock"
+	lockLeaseDuration     = 30 * time.Second
+	lockHeartbeatPeriod   = lockLeaseDuration / 3
+	lockRetryPeriod       = time.Second
+	duplicateKeyErrorCode = 11000
 )
 
+type LockRecord struct {
+	ID         string    `bson:"_id"`
+	Owner      string    `bson:"owner"`
+	Host       string    `bson:"host"`
+	PID        int       `bson:"pid"`
+	AcquiredAt time.Time `bson:"acquired_at"`
+	ExpiresAt  time.Time `bson:"expires_at"`
+}
+
+// lockStore keeps lock record in database. Tests replace it with in-memory one.
+type lockStore interface {
+	insert(ctx context.Context, record *LockRecord) (bool, custom_error.CustomError)
+	takeOverExpired(ctx context.Context, record *LockRecord) (bool, custom_error.CustomError)
+	extend(ctx context.Context, owner string, expiresAt time.Time) (bool, custom_error.CustomError)
+	remove(ctx context.Context, owner string) custom_error.CustomError
+	holder(ctx context.Context) string
+}
+
+type collectionLockStore struct {
+	locks *mgo.Collection
+}
+
+func (s *collectionLockStore) insert(ctx context.Context, record *LockRecord) (bool, custom_error.CustomError) {
+	_, err := s.locks.InsertOne(ctx, record)
+	if err == nil {
+		return true, nil
+	}
+	if isDuplicateKeyError(err) {
+		return false, nil
+	}
+	return false, custom_error.MakeErrorf("Failed to insert lock record. Error: %v", err)
+}
+
+func (s *collectionLockStore) takeOverExpired(ctx context.Context, record *LockRecord) (bool, custom_error.CustomError) {
+	filter := map[string]interface{}{
+		"_id":        migrationLockID,
+		"expires_at": map[string]interface{}{"$lt": record.AcquiredAt},
+	}
+	res, err := s.locks.ReplaceOne(ctx, filter, record)
+	if err != nil {
+		return false, custom_error.MakeErrorf("Failed to take over expired lock. Error: %v", err)
+	}
+	return res.ModifiedCount > 0, nil
+}
+
+func (s *collectionLockStore) extend(ctx context.Context, owner string, expiresAt time.Time) (bool, custom_error.CustomError) {
+	filter := map[string]interface{}{"_id": migrationLockID, "owner": owner}
+	update := map[string]interface{}{"$set": map[string]interface{}{"expires_at": expiresAt.UTC()}}
+	res, err := s.locks.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, custom_error.MakeErrorf("Failed to extend migration lock. Error: %v", err)
+	}
+	return res.MatchedCount > 0, nil
+}
+
+func (s *collectionLockStore) remove(ctx context.Context, owner string) custom_error.CustomError {
+	_, err := s.locks.DeleteOne(ctx, map[string]interface{}{"_id": migrationLockID, "owner": owner})
+	if err != nil {
+		return custom_error.MakeErrorf("Failed to release migration lock. Error: %v", err)
+	}
+	return nil
+}
+
+func (s *collectionLockStore) holder(ctx context.Context) string {
+	holder := LockRecord{}
+	err := s.locks.FindOne(ctx, map[string]interface{}{"_id": migrationLockID}).Decode(&holder)
+	if err != nil {
+		return "unknown"
+	}
+	return fmt.Sprintf("owner '%v', host '%v', pid %v, expires at %v", holder.Owner, holder.Host, holder.PID, holder.ExpiresAt)
+}
+
+type lockTimings struct {
+	lease     time.Duration
+	heartbeat time.Duration
+	retry     time.Duration
+}
+
+var defaultLockTimings = lockTimings{
+	lease:     lockLeaseDuration,
+	heartbeat: lockHeartbeatPeriod,
+	retry:     lockRetryPeriod,
+}
+
 type mongoLock struct {
-	/*db *mgo.Database*/
+	store   lockStore
+	owner   string
+	timings lockTimings
+	log     logs.Logger
+	stop    chan struct{}
+	lost    chan struct{}
+	release sync.Once
+	wg      sync.WaitGroup
+}
+
+func (l *mongoLock) heartbeat() {
+	defer l.wg.Done()
+	ticker := time.NewTicker(l.timings.heartbeat)
+	defer ticker.Stop()
+	expiresAt := time.Now().Add(l.timings.lease)
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			extendedTill := time.Now().Add(l.timings.lease)
+			extended, err := l.store.extend(context.Background(), l.owner, extendedTill)
+			if err != nil {
+				l.log.Errorf("Failed to extend migration lock. Error: %v", err)
+				if time.Now().Before(expiresAt) {
+					continue
+				}
+				l.log.Errorf("Migration lock lease expired. Owner: %v", l.owner)
+				close(l.lost)
+				return
+			}
+			if !extended {
+				l.log.Errorf("Migration lock was lost. Owner: %v", l.owner)
+				close(l.lost)
+				return
+			}
+			expiresAt = extendedTill
+		}
+	}
+}
+
+func (l *mongoLock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Unlock stops heartbeat and removes lock record. Calls after the first one do nothing.
+func (l *mongoLock) Unlock() error {
+	var err custom_error.CustomError
+	l.release.Do(func() {
+		close(l.stop)
+		l.wg.Wait()
+		err = l.store.remove(context.Background(), l.owner)
+		if err == nil {
+			l.log.Infof("Migration lock released. Owner: %v", l.owner)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func isDuplicateKeyError(err error) bool {
+	writeErr, ok := err.(mgo.WriteException)
+	if !ok {
+		return false
+	}
+	for i := range writeErr.WriteErrors {
+		if writeErr.WriteErrors[i].Code == duplicateKeyErrorCode {
+			return true
+		}
+	}
+	return false
 }
 
-func Lock( /*db *mgo.Database*/ ) (primitives.SyncLock, custom_error.CustomError) {
-	/*if db == nil {
+func newLockRecord(owner string, host string, lease time.Duration) *LockRecord {
+	now := time.Now().UTC()
+	return &LockRecord{
+		ID:         migrationLockID,
+		Owner:      owner,
+		Host:       host,
+		PID:        os.Getpid(),
+		AcquiredAt: now,
+		ExpiresAt:  now.Add(lease),
+	}
+}
+
+func tryLock(ctx context.Context, store lockStore, record *LockRecord) (bool, custom_error.CustomError) {
+	inserted, err := store.insert(ctx, record)
+	if err != nil || inserted {
+		return inserted, err
+	}
+	return store.takeOverExpired(ctx, record)
+}
+
+func acquireLock(ctx context.Context, store lockStore, owner string, host string, waitTimeout time.Duration, timings lockTimings, log logs.Logger) (*mongoLock, custom_error.CustomError) {
+	deadline := time.Now().Add(waitTimeout)
+	for {
+		acquired, errValue := tryLock(ctx, store, newLockRecord(owner, host, timings.lease))
+		if errValue != nil {
+			return nil, custom_error.NewErrorf(errValue, "Failed to acquire migration lock.")
+		}
+		if acquired {
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, custom_error.MakeErrorf("mongo seems to be locked. Lock holder: %v", store.holder(ctx))
+		}
+		log.Infof("Waiting for migration lock. Lock holder: %v", store.holder(ctx))
+		select {
+		case <-ctx.Done():
+			return nil, custom_error.MakeErrorf("Stopped waiting for migration lock. Error: %v", ctx.Err())
+		case <-time.After(timings.retry):
+		}
+	}
+	log.Infof("Migration lock acquired. Owner: %v", owner)
+	lock := &mongoLock{
+		store:   store,
+		owner:   owner,
+		timings: timings,
+		log:     log,
+		stop:    make(chan struct{}),
+		lost:    make(chan struct{}),
+	}
+	lock.wg.Add(1)
+	go lock.heartbeat()
+	return lock, nil
+}
+
+func Lock(ctx context.Context, db *mgo.Database, waitTimeout time.Duration, log logs.Logger) (primitives.SyncLock, custom_error.CustomError) {
+	if db == nil {
 		return nil, custom_error.MakeErrorf("nil db-object provided")
 	}
-	locks := db.C("mongol_migration_lock")
+	locks := db.Collection(COLLECTION_NAME_LOCKS)
 	if locks == nil {
 		return nil, custom_error.MakeErrorf("failed to get collection of locks")
 	}
-	lockCount, err := locks.Count()
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	owner := fmt.Sprintf("%v:%v:%v", host, os.Getpid(), primitive.NewObjectID().Hex())
+	lock, errValue := acquireLock(ctx, &collectionLockStore{locks: locks}, owner, host, waitTimeout, defaultLockTimings, log)
+	if errValue != nil {
+		return nil, errValue
+	}
+	return lock, nil
+}
+
+func ReleaseLocks(ctx context.Context, db *mgo.Database) (int64, custom_error.CustomError) {
+	if db == nil {
+		return 0, custom_error.MakeErrorf("nil db-object provided")
+	}
+	res, err := db.Collection(COLLECTION_NAME_LOCKS).DeleteMany(ctx, map[string]interface{}{})
 	if err != nil {
-		return nil, custom_error.MakeErrorf("failed to get lock-count. Error: %v", err)
+		return 0, custom_error.MakeErrorf("Failed to release locks. Error: %v", err)
 	}
-	if lockCount > 0 {
-		return nil, custom_error.MakeErrorf("mongo seems to be locked")
-	}*/
-	return nil, custom_error.MakeErrorf("Not implemented")
+	return res.DeletedCount, nil
 }
@@ -0,0 +1,164 @@
+package mongo
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coldze/primitives/custom_error"
+	"github.com/coldze/primitives/logs"
+)
+
+var testLockTimings = lockTimings{
+	lease:     60 * time.Millisecond,
+	heartbeat: 20 * time.Millisecond,
+	retry:     10 * time.Millisecond,
+}
+
+type memoryLockStore struct {
+	mutex  sync.Mutex
+	record *LockRecord
+}
+
+func (s *memoryLockStore) insert(ctx context.Context, record *LockRecord) (bool, custom_error.CustomError) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.record != nil {
+		return false, nil
+	}
+	copied := *record
+	s.record = &copied
+	return true, nil
+}
+
+func (s *memoryLockStore) takeOverExpired(ctx context.Context, record *LockRecord) (bool, custom_error.CustomError) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.record == nil || !s.record.ExpiresAt.Before(record.AcquiredAt) {
+		return false, nil
+	}
+	copied := *record
+	s.record = &copied
+	return true, nil
+}
+
+func (s *memoryLockStore) extend(ctx context.Context, owner string, expiresAt time.Time) (bool, custom_error.CustomError) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.record == nil || s.record.Owner != owner {
+		return false, nil
+	}
+	s.record.ExpiresAt = expiresAt
+	return true, nil
+}
+
+func (s *memoryLockStore) remove(ctx context.Context, owner string) custom_error.CustomError {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.record != nil && s.record.Owner == owner {
+		s.record = nil
+	}
+	return nil
+}
+
+func (s *memoryLockStore) holder(ctx context.Context) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.record == nil {
+		return "none"
+	}
+	return s.record.Owner
+}
+
+func (s *memoryLockStore) owner() string {
+	return s.holder(context.Background())
+}
+
+func isClosed(channel <-chan struct{}, timeout time.Duration) bool {
+	select {
+	case <-channel:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func TestLockIsExclusiveAndExtended(t *testing.T) {
+	store := &memoryLockStore{}
+	log := logs.NewStdLogger()
+	first, err := acquireLock(context.Background(), store, "first", "host", 0, testLockTimings, log)
+	if err != nil {
+		t.Fatalf("Failed to acquire free lock: %v", err)
+	}
+	_, err = acquireLock(context.Background(), store, "second", "host", 3*testLockTimings.lease, testLockTimings, log)
+	if err == nil {
+		t.Fatalf("Lock, extended by heartbeat, was acquired twice")
+	}
+	if isClosed(first.Lost(), 0) {
+		t.Fatalf("Held lock is reported as lost")
+	}
+	unlockErr := first.Unlock()
+	if unlockErr != nil {
+		t.Fatalf("Failed to unlock: %v", unlockErr)
+	}
+	unlockErr = first.Unlock()
+	if unlockErr != nil {
+		t.Fatalf("Second unlock failed: %v", unlockErr)
+	}
+	if store.owner() != "none" {
+		t.Fatalf("Lock record is not removed: %v", store.owner())
+	}
+	second, err := acquireLock(context.Background(), store, "second", "host", 0, testLockTimings, log)
+	if err != nil {
+		t.Fatalf("Failed to acquire released lock: %v", err)
+	}
+	second.Unlock()
+}
+
+func TestExpiredLockIsTakenOver(t *testing.T) {
+	store := &memoryLockStore{record: newLockRecord("crashed", "host", -time.Second)}
+	lock, err := acquireLock(context.Background(), store, "next", "host", 0, testLockTimings, logs.NewStdLogger())
+	if err != nil {
+		t.Fatalf("Failed to take over expired lock: %v", err)
+	}
+	defer lock.Unlock()
+	if store.owner() != "next" {
+		t.Fatalf("Expected lock to be held by 'next', got: %v", store.owner())
+	}
+}
+
+func TestLostLockIsReported(t *testing.T) {
+	store := &memoryLockStore{}
+	lock, err := acquireLock(context.Background(), store, "first", "host", 0, testLockTimings, logs.NewStdLogger())
+	if err != nil {
+		t.Fatalf("Failed to acquire lock: %v", err)
+	}
+	defer lock.Unlock()
+	store.mutex.Lock()
+	store.record = newLockRecord("other", "host", time.Minute)
+	store.mutex.Unlock()
+	if !isClosed(lock.Lost(), 5*testLockTimings.heartbeat) {
+		t.Fatalf("Lost lock is not reported")
+	}
+	if store.owner() != "other" {
+		t.Fatalf("Lock of other owner was changed: %v", store.owner())
+	}
+}
+
+func TestLockWaitStopsOnCancel(t *testing.T) {
+	store := &memoryLockStore{record: newLockRecord("other", "host", time.Minute)}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(3 * testLockTimings.retry)
+		cancel()
+	}()
+	started := time.Now()
+	_, err := acquireLock(ctx, store, "waiting", "host", time.Minute, testLockTimings, logs.NewStdLogger())
+	if err == nil {
+		t.Fatalf("Expected cancelled wait to fail")
+	}
+	if time.Since(started) > time.Second {
+		t.Fatalf("Wait wasn't stopped by cancellation")
+	}
+}
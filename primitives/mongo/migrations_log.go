@@ -0,0 +1,248 @@
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"github.com/coldze/mongol/engine"
+	"github.com/coldze/primitives/custom_error"
+	"go.mongodb.org/mongo-driver/bson"
+	mgo "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func getLastApplied(ctx context.Context, migrations *mgo.Collection) (*ChangeRecord, custom_error.CustomError) {
+	opts := options.FindOne().SetSort(bson.D{{Key: "applied_at_utc", Value: -1}})
+	record := ChangeRecord{}
+	err := migrations.FindOne(ctx, map[string]interface{}{}, opts).Decode(&record)
+	if err == mgo.ErrNoDocuments {
+		return nil, custom_error.MakeErrorf("No applied changes found")
+	}
+	if err != nil {
+		return nil, custom_error.MakeErrorf("Failed to get last applied change. Error: %v", err)
+	}
+	return &record, nil
+}
+
+func collectChangeIDs(ctx context.Context, migrations *mgo.Collection, filter interface{}, opts ...*options.FindOptions) (map[string]struct{}, custom_error.CustomError) {
+	res, err := migrations.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, custom_error.MakeErrorf("Failed to get changes from DB. Error: %v", err)
+	}
+	defer res.Close(ctx)
+	changeIDs := map[string]struct{}{}
+	for res.Next(ctx) {
+		record := ChangeRecord{}
+		err := res.Decode(&record)
+		if err != nil {
+			return nil, custom_error.MakeErrorf("Failed to decode change record. Error: %v", err)
+		}
+		changeIDs[record.ID] = struct{}{}
+	}
+	if res.Err() != nil {
+		return nil, custom_error.MakeErrorf("Failed to iterate over changes. Error: %v", res.Err())
+	}
+	return changeIDs, nil
+}
+
+func TagLastApplied(ctx context.Context, db *mgo.Database, collectionName string, tag string) (string, custom_error.CustomError) {
+	if len(tag) <= 0 {
+		return "", custom_error.MakeErrorf("Empty tag provided")
+	}
+	migrations := db.Collection(collectionName)
+	count, err := migrations.CountDocuments(ctx, map[string]interface{}{"tag": tag})
+	if err != nil {
+		return "", custom_error.MakeErrorf("Failed to check tag '%v'. Error: %v", tag, err)
+	}
+	if count > 0 {
+		return "", custom_error.MakeErrorf("Tag '%v' already exists", tag)
+	}
+	record, errValue := getLastApplied(ctx, migrations)
+	if errValue != nil {
+		return "", custom_error.NewErrorf(errValue, "Failed to find change to tag")
+	}
+	update := map[string]interface{}{"$set": map[string]interface{}{"tag": tag}}
+	_, err = migrations.UpdateOne(ctx, map[string]interface{}{"change_id": record.ID}, update)
+	if err != nil {
+		return "", custom_error.MakeErrorf("Failed to tag change '%v'. Error: %v", record.ID, err)
+	}
+	return record.ID, nil
+}
+
+func GetAppliedAfterTag(ctx context.Context, db *mgo.Database, collectionName string, tag string) (map[string]struct{}, custom_error.CustomError) {
+	migrations := db.Collection(collectionName)
+	record := ChangeRecord{}
+	err := migrations.FindOne(ctx, map[string]interface{}{"tag": tag}).Decode(&record)
+	if err == mgo.ErrNoDocuments {
+		return nil, custom_error.MakeErrorf("Tag '%v' not found", tag)
+	}
+	if err != nil {
+		return nil, custom_error.MakeErrorf("Failed to get tag '%v'. Error: %v", tag, err)
+	}
+	filter := map[string]interface{}{"applied_at_utc": map[string]interface{}{"$gt": record.AppliedAt}}
+	changeIDs, errValue := collectChangeIDs(ctx, migrations, filter)
+	if errValue != nil {
+		return nil, custom_error.NewErrorf(errValue, "Failed to get changes applied after tag '%v'", tag)
+	}
+	return changeIDs, nil
+}
+
+// GetLastApplied returns last count applied changes among changeIDs - changes of the changelog, that match contexts filter.
+// It fails, if there are less applied changes, than requested.
+func GetLastApplied(ctx context.Context, db *mgo.Database, collectionName string, count int64, changeIDs map[string]struct{}) (map[string]struct{}, custom_error.CustomError) {
+	if count <= 0 {
+		return nil, custom_error.MakeErrorf("Expected positive amount of changes. Got: %v", count)
+	}
+	candidates := make([]string, 0, len(changeIDs))
+	for changeID := range changeIDs {
+		candidates = append(candidates, changeID)
+	}
+	filter := map[string]interface{}{"change_id": map[string]interface{}{"$in": candidates}}
+	opts := options.Find().SetSort(bson.D{{Key: "applied_at_utc", Value: -1}}).SetLimit(count)
+	lastApplied, errValue := collectChangeIDs(ctx, db.Collection(collectionName), filter, opts)
+	if errValue != nil {
+		return nil, custom_error.NewErrorf(errValue, "Failed to get last %v applied changes", count)
+	}
+	if int64(len(lastApplied)) < count {
+		return nil, custom_error.MakeErrorf("Requested rollback of %v changes, but only %v applied changes match changelog and contexts", count, len(lastApplied))
+	}
+	return lastApplied, nil
+}
+
+func GetAppliedAfter(ctx context.Context, db *mgo.Database, collectionName string, date time.Time) (map[string]struct{}, custom_error.CustomError) {
+	filter := map[string]interface{}{"applied_at_utc": map[string]interface{}{"$gt": date.UnixNano()}}
+	changeIDs, errValue := collectChangeIDs(ctx, db.Collection(collectionName), filter)
+	if errValue != nil {
+		return nil, custom_error.NewErrorf(errValue, "Failed to get changes applied after %v", date)
+	}
+	return changeIDs, nil
+}
+
+type RemapResult int
+
+const (
+	REMAP_RESULT_NOT_FOUND RemapResult = iota
+	REMAP_RESULT_REMAPPED
+	REMAP_RESULT_TARGET_EXISTS
+	REMAP_RESULT_CHECKSUM_MISMATCH
+)
+
+// RemapChangeID renames record only if its checksum is one of the change's checksums: positional ID points to another
+// change, when changes were inserted before remap.
+func RemapChangeID(ctx context.Context, db *mgo.Database, collectionName string, fromID string, toID string, hashes []string) (RemapResult, custom_error.CustomError) {
+	migrations := db.Collection(collectionName)
+	count, err := migrations.CountDocuments(ctx, map[string]interface{}{"change_id": toID})
+	if err != nil {
+		return REMAP_RESULT_NOT_FOUND, custom_error.MakeErrorf("Failed to check change '%v'. Error: %v", toID, err)
+	}
+	if count > 0 {
+		return REMAP_RESULT_TARGET_EXISTS, nil
+	}
+	filter := map[string]interface{}{"change_id": fromID, "hash": map[string]interface{}{"$in": hashes}}
+	update := map[string]interface{}{"$set": map[string]interface{}{"change_id": toID}}
+	res, err := migrations.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return REMAP_RESULT_NOT_FOUND, custom_error.MakeErrorf("Failed to remap change '%v' to '%v'. Error: %v", fromID, toID, err)
+	}
+	if res.MatchedCount > 0 {
+		return REMAP_RESULT_REMAPPED, nil
+	}
+	count, err = migrations.CountDocuments(ctx, map[string]interface{}{"change_id": fromID})
+	if err != nil {
+		return REMAP_RESULT_NOT_FOUND, custom_error.MakeErrorf("Failed to check change '%v'. Error: %v", fromID, err)
+	}
+	if count > 0 {
+		return REMAP_RESULT_CHECKSUM_MISMATCH, nil
+	}
+	return REMAP_RESULT_NOT_FOUND, nil
+}
+
+// UpgradeChecksum replaces checksum of change's record only if it still has the expected one.
+func UpgradeChecksum(ctx context.Context, db *mgo.Database, collectionName string, changeID string, fromHash string, toHash string) (bool, custom_error.CustomError) {
+	migrations := db.Collection(collectionName)
+	update := map[string]interface{}{"$set": map[string]interface{}{"hash": toHash}}
+	res, err := migrations.UpdateOne(ctx, map[string]interface{}{"change_id": changeID, "hash": fromHash}, update)
+	if err != nil {
+		return false, custom_error.MakeErrorf("Failed to upgrade checksum of change '%v'. Error: %v", changeID, err)
+	}
+	return res.MatchedCount > 0, nil
+}
+
+func getRecordsInState(ctx context.Context, db *mgo.Database, collectionName string, states ...string) ([]*ChangeRecord, custom_error.CustomError) {
+	filter := map[string]interface{}{"state": map[string]interface{}{"$in": states}}
+	opts := options.Find().SetSort(bson.D{{Key: "updated_at_utc", Value: 1}})
+	res, err := db.Collection(collectionName).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, custom_error.MakeErrorf("Failed to get changes in state %v from DB. Error: %v", states, err)
+	}
+	defer res.Close(ctx)
+	records := []*ChangeRecord{}
+	for res.Next(ctx) {
+		record := &ChangeRecord{}
+		err := res.Decode(record)
+		if err != nil {
+			return nil, custom_error.MakeErrorf("Failed to decode change record. Error: %v", err)
+		}
+		records = append(records, record)
+	}
+	if res.Err() != nil {
+		return nil, custom_error.MakeErrorf("Failed to iterate over changes in state %v. Error: %v", states, res.Err())
+	}
+	return records, nil
+}
+
+func GetUnfinished(ctx context.Context, db *mgo.Database, collectionName string) ([]*ChangeRecord, custom_error.CustomError) {
+	return getRecordsInState(ctx, db, collectionName, engine.JOURNAL_STATE_IN_PROGRESS, engine.JOURNAL_STATE_FAILED)
+}
+
+// GetMarkedRan returns IDs of changes, that were recorded without running, because their preconditions failed with MARK_RAN.
+func GetMarkedRan(ctx context.Context, db *mgo.Database, collectionName string) (map[string]struct{}, custom_error.CustomError) {
+	records, err := getRecordsInState(ctx, db, collectionName, engine.JOURNAL_STATE_MARK_RAN)
+	if err != nil {
+		return nil, err
+	}
+	markedRan := map[string]struct{}{}
+	for _, record := range records {
+		markedRan[record.ID] = struct{}{}
+	}
+	return markedRan, nil
+}
+
+// ResolveUnfinished resolves unfinished operation: applied reports, that operation took effect. Change is executed, when
+// migration took effect or rollback didn't. Otherwise record of change, that was applied before, is restored to executed
+// state with its previous checksum, tag and time, and record of never applied change is removed, so change is pending again.
+func ResolveUnfinished(ctx context.Context, db *mgo.Database, collectionName string, record *ChangeRecord, applied bool) custom_error.CustomError {
+	migrations := db.Collection(collectionName)
+	filter := map[string]interface{}{"change_id": record.ID, "state": record.State}
+	executed := applied
+	if record.Operation == engine.JOURNAL_OPERATION_ROLLBACK {
+		executed = !applied
+	}
+	if !executed && (record.AppliedAt <= 0 || record.Operation == engine.JOURNAL_OPERATION_ROLLBACK) {
+		_, err := migrations.DeleteOne(ctx, filter)
+		if err != nil {
+			return custom_error.MakeErrorf("Failed to remove record of change '%v'. Error: %v", record.ID, err)
+		}
+		return nil
+	}
+	set := map[string]interface{}{"state": engine.JOURNAL_STATE_EXECUTED}
+	if executed && record.Operation != engine.JOURNAL_OPERATION_ROLLBACK {
+		now := time.Now().UnixNano()
+		set["last_applied_at_utc"] = now
+		if record.AppliedAt <= 0 {
+			set["applied_at_utc"] = now
+		}
+		if len(record.PendingHash) > 0 {
+			set["hash"] = record.PendingHash
+		}
+	}
+	update := map[string]interface{}{
+		"$set":   set,
+		"$unset": map[string]interface{}{"operation": "", "error": "", "updated_at_utc": "", "pending_hash": ""},
+	}
+	_, err := migrations.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return custom_error.MakeErrorf("Failed to mark change '%v' as executed. Error: %v", record.ID, err)
+	}
+	return nil
+}
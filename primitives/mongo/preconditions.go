@@ -0,0 +1,133 @@
+package mongo
+
+import (
+	"context"
+
+	"github.com/coldze/mongol/engine"
+	"github.com/coldze/primitives/custom_error"
+	"go.mongodb.org/mongo-driver/bson"
+	mgo "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type preconditionChecker struct {
+	ctx           context.Context
+	db            *mgo.Database
+	serverVersion []int
+}
+
+func (p *preconditionChecker) collectionExists(name string) (bool, custom_error.CustomError) {
+	cursor, err := p.db.ListCollections(p.ctx, map[string]interface{}{"name": name})
+	if err != nil {
+		return false, custom_error.MakeErrorf("Failed to list collections. Error: %v", err)
+	}
+	defer cursor.Close(p.ctx)
+	return cursor.Next(p.ctx), nil
+}
+
+func (p *preconditionChecker) indexExists(condition *engine.IndexExistsCondition) (bool, custom_error.CustomError) {
+	exists, errValue := p.collectionExists(condition.Collection)
+	if errValue != nil {
+		return false, errValue
+	}
+	if !exists {
+		return false, nil
+	}
+	cursor, err := p.db.Collection(condition.Collection).Indexes().List(p.ctx)
+	if err != nil {
+		return false, custom_error.MakeErrorf("Failed to list indexes of '%v'. Error: %v", condition.Collection, err)
+	}
+	defer cursor.Close(p.ctx)
+	for cursor.Next(p.ctx) {
+		index := struct {
+			Name string `bson:"name"`
+		}{}
+		err = cursor.Decode(&index)
+		if err != nil {
+			return false, custom_error.MakeErrorf("Failed to decode index of '%v'. Error: %v", condition.Collection, err)
+		}
+		if index.Name == condition.Name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (p *preconditionChecker) countDocuments(collection string, filter interface{}, limit int64) (int64, custom_error.CustomError) {
+	opts := options.Count()
+	if limit > 0 {
+		opts = opts.SetLimit(limit)
+	}
+	count, err := p.db.Collection(collection).CountDocuments(p.ctx, filter, opts)
+	if err != nil {
+		return 0, custom_error.MakeErrorf("Failed to count documents in '%v'. Error: %v", collection, err)
+	}
+	return count, nil
+}
+
+func (p *preconditionChecker) getServerVersion() ([]int, custom_error.CustomError) {
+	if p.serverVersion != nil {
+		return p.serverVersion, nil
+	}
+	buildInfo := struct {
+		Version string `bson:"version"`
+	}{}
+	err := p.db.RunCommand(p.ctx, bson.D{{Key: "buildInfo", Value: 1}}).Decode(&buildInfo)
+	if err != nil {
+		return nil, custom_error.MakeErrorf("Failed to get server version. Error: %v", err)
+	}
+	version, errValue := engine.ParseVersion(buildInfo.Version)
+	if errValue != nil {
+		return nil, custom_error.NewErrorf(errValue, "Failed to parse server version")
+	}
+	p.serverVersion = version
+	return version, nil
+}
+
+func (p *preconditionChecker) serverVersionInRange(condition *engine.ServerVersionCondition) (bool, custom_error.CustomError) {
+	version, errValue := p.getServerVersion()
+	if errValue != nil {
+		return false, errValue
+	}
+	min, errValue := engine.ParseVersion(condition.Min)
+	if errValue != nil {
+		return false, errValue
+	}
+	max, errValue := engine.ParseVersion(condition.Max)
+	if errValue != nil {
+		return false, errValue
+	}
+	return engine.CompareVersions(version, min) >= 0 && engine.CompareVersions(version, max) <= 0, nil
+}
+
+func (p *preconditionChecker) Check(precondition *engine.Precondition) (bool, custom_error.CustomError) {
+	switch {
+	case len(precondition.CollectionExists) > 0:
+		return p.collectionExists(precondition.CollectionExists)
+	case precondition.IndexExists != nil:
+		return p.indexExists(precondition.IndexExists)
+	case precondition.DocumentCount != nil:
+		count, errValue := p.countDocuments(precondition.DocumentCount.Collection, precondition.DocumentCount.Filter, 0)
+		if errValue != nil {
+			return false, errValue
+		}
+		return count == precondition.DocumentCount.Count, nil
+	case precondition.FieldExists != nil:
+		filter := map[string]interface{}{precondition.FieldExists.Field: map[string]interface{}{"$exists": true}}
+		count, errValue := p.countDocuments(precondition.FieldExists.Collection, filter, 1)
+		if errValue != nil {
+			return false, errValue
+		}
+		return count > 0, nil
+	case precondition.ServerVersion != nil:
+		return p.serverVersionInRange(precondition.ServerVersion)
+	}
+	return false, custom_error.MakeErrorf("Unknown precondition")
+}
+
+func NewPreconditionChecker(ctx context.Context, db *mgo.Database) engine.PreconditionChecker {
+	return &preconditionChecker{
+		ctx: ctx,
+		db:  db,
+	}
+}
@@ -0,0 +1,32 @@
+package mongo
+
+import (
+	"io"
+
+	"github.com/coldze/mongol/engine"
+	"github.com/coldze/primitives/custom_error"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type DocumentRecorder struct {
+	output io.Writer
+}
+
+func (r *DocumentRecorder) Apply(value interface{}) custom_error.CustomError {
+	data, err := bson.MarshalExtJSON(value, true, false)
+	if err != nil {
+		return custom_error.MakeErrorf("Failed to encode command into ext-json. Error: %v", err)
+	}
+	data = append(data, '\n')
+	_, err = r.output.Write(data)
+	if err != nil {
+		return custom_error.MakeErrorf("Failed to record command. Error: %v", err)
+	}
+	return nil
+}
+
+func NewDocumentRecorder(output io.Writer) engine.DocumentApplier {
+	return &DocumentRecorder{
+		output: output,
+	}
+}
@@ -0,0 +1,144 @@
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"github.com/coldze/mongol/engine"
+	"github.com/coldze/primitives/custom_error"
+	"github.com/coldze/primitives/logs"
+	"go.mongodb.org/mongo-driver/bson"
+	mgo "go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	minReplicaSetTransactionsWireVersion = 7
+	minShardedTransactionsWireVersion    = 8
+	namespaceExistsErrorCode             = 48
+	maxTimeMSExpiredErrorCode            = 50
+	transientTransactionErrorLabel       = "TransientTransactionError"
+	unknownCommitResultErrorLabel        = "UnknownTransactionCommitResult"
+	transactionRetryTimeout              = 120 * time.Second
+)
+
+// sessionApplier remembers, that command failed with transient transaction error: migrations wrap errors of commands,
+// so the label can't be checked on error, returned from transaction's body.
+type sessionApplier struct {
+	*DbChanger
+	transient bool
+}
+
+func (a *sessionApplier) Apply(value interface{}) custom_error.CustomError {
+	err := a.DbChanger.Apply(value)
+	reply, ok := GetWriteOperationsError(err)
+	if ok && reply.HasErrorLabel(transientTransactionErrorLabel) {
+		a.transient = true
+	}
+	return err
+}
+
+type serverDescription struct {
+	SetName        string `bson:"setName,omitempty"`
+	Msg            string `bson:"msg,omitempty"`
+	MaxWireVersion int32  `bson:"maxWireVersion"`
+}
+
+func SupportsTransactions(ctx context.Context, db *mgo.Database) (bool, custom_error.CustomError) {
+	description := serverDescription{}
+	err := db.RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&description)
+	if err != nil {
+		return false, custom_error.MakeErrorf("Failed to get server description. Error: %v", err)
+	}
+	if len(description.SetName) > 0 {
+		return description.MaxWireVersion >= minReplicaSetTransactionsWireVersion, nil
+	}
+	if description.Msg == "isdbgrid" {
+		return description.MaxWireVersion >= minShardedTransactionsWireVersion, nil
+	}
+	return false, nil
+}
+
+func EnsureCollection(ctx context.Context, db *mgo.Database, collectionName string) custom_error.CustomError {
+	err := db.RunCommand(ctx, bson.D{{Key: "create", Value: collectionName}}).Err()
+	if err == nil {
+		return nil
+	}
+	cmdErr, ok := err.(mgo.CommandError)
+	if ok && cmdErr.Code == namespaceExistsErrorCode {
+		return nil
+	}
+	return custom_error.MakeErrorf("Failed to create collection '%v'. Error: %v", collectionName, err)
+}
+
+func hasErrorLabel(err error, label string) bool {
+	cmdErr, ok := err.(mgo.CommandError)
+	return ok && cmdErr.HasErrorLabel(label)
+}
+
+func canRetryCommit(err error, deadline time.Time) bool {
+	cmdErr, ok := err.(mgo.CommandError)
+	return ok && cmdErr.HasErrorLabel(unknownCommitResultErrorLabel) && cmdErr.Code != maxTimeMSExpiredErrorCode && time.Now().Before(deadline)
+}
+
+func commitTransaction(sc mgo.SessionContext, deadline time.Time) error {
+	for {
+		err := sc.CommitTransaction(sc)
+		if err == nil || !canRetryCommit(err, deadline) {
+			return err
+		}
+	}
+}
+
+// runTransaction has semantics of driver's Session.WithTransaction: body is run again on TransientTransactionError and
+// commit is retried on UnknownTransactionCommitResult, until retry timeout expires.
+func runTransaction(sc mgo.SessionContext, db *mgo.Database, body func(applier engine.DocumentApplier) custom_error.CustomError, log logs.Logger) custom_error.CustomError {
+	deadline := time.Now().Add(transactionRetryTimeout)
+	for {
+		err := sc.StartTransaction()
+		if err != nil {
+			return custom_error.MakeErrorf("Failed to start transaction. Error: %v", err)
+		}
+		applier := &sessionApplier{DbChanger: &DbChanger{db: db, context: sc}}
+		errValue := body(applier)
+		if errValue != nil {
+			abortErr := sc.AbortTransaction(sc)
+			if abortErr != nil {
+				log.Errorf("Failed to abort transaction. Error: %v", abortErr)
+			}
+			if applier.transient && time.Now().Before(deadline) {
+				log.Warningf("Transaction failed with transient error, retrying. Error: %v", errValue)
+				continue
+			}
+			return errValue
+		}
+		err = commitTransaction(sc, deadline)
+		if err == nil {
+			return nil
+		}
+		if hasErrorLabel(err, transientTransactionErrorLabel) && time.Now().Before(deadline) {
+			log.Warningf("Transaction commit failed with transient error, retrying. Error: %v", err)
+			continue
+		}
+		return custom_error.MakeErrorf("Failed to commit transaction. Error: %v", err)
+	}
+}
+
+// NewMongoSessionRunner runs body in a transaction of a new session. Session's context is used only inside of body.
+func NewMongoSessionRunner(ctx context.Context, db *mgo.Database, log logs.Logger) engine.SessionRunner {
+	return func(body func(applier engine.DocumentApplier) custom_error.CustomError) custom_error.CustomError {
+		session, err := db.Client().StartSession()
+		if err != nil {
+			return custom_error.MakeErrorf("Failed to start session. Error: %v", err)
+		}
+		defer session.EndSession(ctx)
+		var result custom_error.CustomError
+		err = mgo.WithSession(ctx, session, func(sc mgo.SessionContext) error {
+			result = runTransaction(sc, db, body, log)
+			return nil
+		})
+		if err != nil {
+			return custom_error.MakeErrorf("Failed to run session. Error: %v", err)
+		}
+		return result
+	}
+}
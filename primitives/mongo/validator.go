@@ -2,26 +2,81 @@ package mongo
 
 import (
 	"context"
+	"time"
 
 	"github.com/coldze/mongol/engine"
 	"github.com/coldze/primitives/custom_error"
 	mgo "go.mongodb.org/mongo-driver/mongo"
 )
 
+type ChangeStatus int
+
+const (
+	CHANGE_STATUS_PENDING ChangeStatus = iota
+	CHANGE_STATUS_APPLIED
+	CHANGE_STATUS_CHECKSUM_MISMATCH
+	CHANGE_STATUS_REAPPLY
+	CHANGE_STATUS_IN_PROGRESS
+	CHANGE_STATUS_FAILED
+)
+
+func (s ChangeStatus) String() string {
+	switch s {
+	case CHANGE_STATUS_PENDING:
+		return "pending"
+	case CHANGE_STATUS_APPLIED:
+		return "applied"
+	case CHANGE_STATUS_CHECKSUM_MISMATCH:
+		return "checksum-mismatch"
+	case CHANGE_STATUS_REAPPLY:
+		return "reapply"
+	case CHANGE_STATUS_IN_PROGRESS:
+		return "in-progress"
+	case CHANGE_STATUS_FAILED:
+		return "failed"
+	}
+	return "unknown"
+}
+
 type changeSetValidator struct {
 	migrations *mgo.Collection
-	applied    ChangeSetConsumer
-	notApplied ChangeSetConsumer
+	consume    ChangeStateConsumer
 }
 
 type ChangeRecord struct {
 	ID        string `bson:"change_id"`
 	Hash      string `bson:"hash"`
-	AppliedAt string `bson:"applied_at"`
+	AppliedAt int64  `bson:"applied_at_utc"`
+	Tag       string `bson:"tag,omitempty"`
+	State     string `bson:"state,omitempty"`
+	Operation string `bson:"operation,omitempty"`
+	Error     string `bson:"error,omitempty"`
+	// PendingHash is checksum of change, that is being applied, while record keeps checksum of previous application.
+	PendingHash string `bson:"pending_hash,omitempty"`
+}
+
+// IsUnfinished reports, that change was interrupted or failed outside of transaction.
+// Records without state were written before journal was introduced and are treated as executed.
+func (r *ChangeRecord) IsUnfinished() bool {
+	return r.State == engine.JOURNAL_STATE_IN_PROGRESS || r.State == engine.JOURNAL_STATE_FAILED
+}
+
+type ChangeState struct {
+	ChangeSetID  string
+	ChangeID     string
+	Status       ChangeStatus
+	Hash         string
+	RecordedHash string
+	AppliedAt    time.Time
+	Operation    string
+	Error        string
+	Modified     bool
 }
 
 type ChangeSetConsumer func(changeID string) custom_error.CustomError
 
+type ChangeStateConsumer func(state *ChangeState) custom_error.CustomError
+
 func (c *changeSetValidator) Process(changeSet *engine.ChangeSet) custom_error.CustomError {
 	if changeSet == nil {
 		return custom_error.MakeErrorf("Failed to validate changeset. Nil pointer provided.")
@@ -58,47 +113,76 @@ func (c *changeSetValidator) Process(changeSet *engine.ChangeSet) custom_error.C
 	}*/
 	for _, change := range changeSet.Changes {
 
-		applied, err := c.processChange(change)
+		state, err := c.processChange(change)
 		if err != nil {
 			return custom_error.NewErrorf(err, "Failed to check change-set with ID %v", changeSet.ID)
 		}
-		if applied {
-			customErr := c.applied(change.ID)
-			if customErr != nil {
-				return custom_error.NewErrorf(customErr, "Failed to send into applied change with ID %v", change.ID)
-			}
-		} else {
-			customErr := c.notApplied(change.ID)
-			if customErr != nil {
-				return custom_error.NewErrorf(customErr, "Failed to send into not-applied change with ID %v", change.ID)
-			}
+		state.ChangeSetID = changeSet.ID
+		err = c.consume(state)
+		if err != nil {
+			return custom_error.NewErrorf(err, "Failed to process state of change with ID %v", change.ID)
 		}
 	}
 	return nil
 }
 
-func (c *changeSetValidator) processChange(change *engine.Change) (bool, custom_error.CustomError) {
+// applyRecord updates state of change with its record from migrations log. It returns true, if state is final.
+func applyRecord(state *ChangeState, change *engine.Change, changeRecord *ChangeRecord) bool {
+	state.RecordedHash = changeRecord.Hash
+	if changeRecord.AppliedAt > 0 {
+		state.AppliedAt = time.Unix(0, changeRecord.AppliedAt).UTC()
+	}
+	if changeRecord.IsUnfinished() {
+		state.Status = CHANGE_STATUS_IN_PROGRESS
+		if changeRecord.State == engine.JOURNAL_STATE_FAILED {
+			state.Status = CHANGE_STATUS_FAILED
+		}
+		state.Operation = changeRecord.Operation
+		state.Error = changeRecord.Error
+		return true
+	}
+	if !change.HasChecksum(changeRecord.Hash) {
+		state.Modified = true
+		if change.RunOnChange || change.RunAlways {
+			state.Status = CHANGE_STATUS_REAPPLY
+			return true
+		}
+		state.Status = CHANGE_STATUS_CHECKSUM_MISMATCH
+		return true
+	}
+	state.Status = CHANGE_STATUS_APPLIED
+	if change.RunAlways {
+		state.Status = CHANGE_STATUS_REAPPLY
+	}
+	return false
+}
+
+func (c *changeSetValidator) processChange(change *engine.Change) (*ChangeState, custom_error.CustomError) {
 	if change == nil {
-		return false, custom_error.MakeErrorf("Failed to validate change. Nil pointer provided.")
+		return nil, custom_error.MakeErrorf("Failed to validate change. Nil pointer provided.")
 	}
 	res, err := c.migrations.Find(context.Background(), map[string]interface{}{"change_id": change.ID})
 	if err != nil {
-		return false, custom_error.MakeErrorf("Failed to get change from DB. Error: %v", err)
+		return nil, custom_error.MakeErrorf("Failed to get change from DB. Error: %v", err)
 	}
 	if res == nil {
-		return false, custom_error.MakeErrorf("Failed to get change from DB. Empty response cursor.")
+		return nil, custom_error.MakeErrorf("Failed to get change from DB. Empty response cursor.")
+	}
+	defer res.Close(context.Background())
+	state := &ChangeState{
+		ChangeID: change.ID,
+		Status:   CHANGE_STATUS_PENDING,
+		Hash:     change.Hash,
 	}
-	found := false
 	for res.Next(context.Background()) {
 		changeRecord := ChangeRecord{}
 		err := res.Decode(&changeRecord)
 		if err != nil {
-			return false, custom_error.MakeErrorf("Failed to get change from DB. Error: %v", err)
+			return nil, custom_error.MakeErrorf("Failed to get change from DB. Error: %v", err)
 		}
-		if changeRecord.Hash != change.Hash {
-			return false, custom_error.MakeErrorf("Checksum failed for change '%v'. Was: %v Now: %v", change.ID, changeRecord.Hash, change.Hash)
+		if applyRecord(state, change, &changeRecord) {
+			return state, nil
 		}
-		found = true
 	}
 	/*if found {
 		customErr := c.applied(change)
@@ -111,17 +195,48 @@ func (c *changeSetValidator) processChange(change *engine.Change) (bool, custom_
 			return false, custom_error.NewErrorf(customErr, "Failed to send into not-applied change with ID %v", change.ID)
 		}
 	}*/
-	return found, nil
+	return state, nil
+}
+
+func newValidatingConsumer(appliedConsumer ChangeSetConsumer, notAppliedConsumer ChangeSetConsumer, reapplyConsumer ChangeSetConsumer) ChangeStateConsumer {
+	return func(state *ChangeState) custom_error.CustomError {
+		switch state.Status {
+		case CHANGE_STATUS_APPLIED:
+			customErr := appliedConsumer(state.ChangeID)
+			if customErr != nil {
+				return custom_error.NewErrorf(customErr, "Failed to send into applied change with ID %v", state.ChangeID)
+			}
+		case CHANGE_STATUS_PENDING:
+			customErr := notAppliedConsumer(state.ChangeID)
+			if customErr != nil {
+				return custom_error.NewErrorf(customErr, "Failed to send into not-applied change with ID %v", state.ChangeID)
+			}
+		case CHANGE_STATUS_REAPPLY:
+			customErr := reapplyConsumer(state.ChangeID)
+			if customErr != nil {
+				return custom_error.NewErrorf(customErr, "Failed to send into reapplied change with ID %v", state.ChangeID)
+			}
+		case CHANGE_STATUS_IN_PROGRESS, CHANGE_STATUS_FAILED:
+			return custom_error.MakeErrorf("Change '%v' has unfinished %v (%v). Error: '%v'. Check database and resolve it with 'mongol repair'", state.ChangeID, state.Operation, state.Status, state.Error)
+		default:
+			return custom_error.MakeErrorf("Checksum failed for change '%v'. Was: %v Now: %v", state.ChangeID, state.RecordedHash, state.Hash)
+		}
+		return nil
+	}
+}
+
+// NewMongoChangeSetValidator fails on checksum mismatch. Changes with runAlways or runOnChange, that have to be applied again, are sent into reapplyConsumer.
+func NewMongoChangeSetValidator(db *mgo.Database, collectionName string, appliedConsumer ChangeSetConsumer, notAppliedConsumer ChangeSetConsumer, reapplyConsumer ChangeSetConsumer) (engine.ChangeSetProcessor, custom_error.CustomError) {
+	return NewMongoChangeSetStateCollector(db, collectionName, newValidatingConsumer(appliedConsumer, notAppliedConsumer, reapplyConsumer))
 }
 
-func NewMongoChangeSetValidator(db *mgo.Database, collectionName string, appliedConsumer ChangeSetConsumer, notAppliedConsumer ChangeSetConsumer) (engine.ChangeSetProcessor, custom_error.CustomError) {
+func NewMongoChangeSetStateCollector(db *mgo.Database, collectionName string, consumer ChangeStateConsumer) (engine.ChangeSetProcessor, custom_error.CustomError) {
 	migrationCollection := db.Collection(collectionName)
 	if migrationCollection == nil {
 		return nil, custom_error.MakeErrorf("Internal error. Nulled collection returned.")
 	}
 	return &changeSetValidator{
 		migrations: migrationCollection,
-		applied:    appliedConsumer,
-		notApplied: notAppliedConsumer,
+		consume:    consumer,
 	}, nil
 }
@@ -0,0 +1,46 @@
+package mongo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coldze/mongol/engine"
+)
+
+func TestApplyRecord(t *testing.T) {
+	appliedAt := time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name     string
+		change   engine.Change
+		record   ChangeRecord
+		status   ChangeStatus
+		modified bool
+		final    bool
+	}{
+		{"applied", engine.Change{Hash: "new"}, ChangeRecord{Hash: "new"}, CHANGE_STATUS_APPLIED, false, false},
+		{"applied with legacy checksum", engine.Change{Hash: "new", LegacyHash: "old"}, ChangeRecord{Hash: "old"}, CHANGE_STATUS_APPLIED, false, false},
+		{"applied before journal", engine.Change{Hash: "new"}, ChangeRecord{Hash: "new", State: ""}, CHANGE_STATUS_APPLIED, false, false},
+		{"marked ran", engine.Change{Hash: "new"}, ChangeRecord{Hash: "new", State: engine.JOURNAL_STATE_MARK_RAN}, CHANGE_STATUS_APPLIED, false, false},
+		{"checksum mismatch", engine.Change{Hash: "new"}, ChangeRecord{Hash: "old"}, CHANGE_STATUS_CHECKSUM_MISMATCH, true, true},
+		{"run on change", engine.Change{Hash: "new", RunOnChange: true}, ChangeRecord{Hash: "old"}, CHANGE_STATUS_REAPPLY, true, true},
+		{"unmodified run on change", engine.Change{Hash: "new", RunOnChange: true}, ChangeRecord{Hash: "new"}, CHANGE_STATUS_APPLIED, false, false},
+		{"run always", engine.Change{Hash: "new", RunAlways: true}, ChangeRecord{Hash: "new"}, CHANGE_STATUS_REAPPLY, false, false},
+		{"modified run always", engine.Change{Hash: "new", RunAlways: true}, ChangeRecord{Hash: "old"}, CHANGE_STATUS_REAPPLY, true, true},
+		{"in progress", engine.Change{Hash: "new"}, ChangeRecord{Hash: "old", State: engine.JOURNAL_STATE_IN_PROGRESS}, CHANGE_STATUS_IN_PROGRESS, false, true},
+		{"failed", engine.Change{Hash: "new"}, ChangeRecord{Hash: "new", State: engine.JOURNAL_STATE_FAILED, Error: "boom"}, CHANGE_STATUS_FAILED, false, true},
+	}
+	for _, c := range cases {
+		c.record.AppliedAt = appliedAt.UnixNano()
+		state := &ChangeState{Status: CHANGE_STATUS_PENDING, Hash: c.change.Hash}
+		final := applyRecord(state, &c.change, &c.record)
+		if state.Status != c.status || state.Modified != c.modified || final != c.final {
+			t.Errorf("%v: expected %v (modified: %v, final: %v), got %v (modified: %v, final: %v)", c.name, c.status, c.modified, c.final, state.Status, state.Modified, final)
+		}
+		if !state.AppliedAt.Equal(appliedAt) {
+			t.Errorf("%v: expected applied at %v, got %v", c.name, appliedAt, state.AppliedAt)
+		}
+		if state.Error != c.record.Error {
+			t.Errorf("%v: expected error '%v', got '%v'", c.name, c.record.Error, state.Error)
+		}
+	}
+}
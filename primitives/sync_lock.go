@@ -2,4 +2,6 @@ package primitives
 
 type SyncLock interface {
 	Unlock() error
+	// Lost is closed, when lock can't be held anymore. Nil channel means lock can't be lost.
+	Lost() <-chan struct{}
 }
@@ -0,0 +1,10 @@
+// mongo-shell style script, executed by mongol's embedded JavaScript engine
+var defaults = {score: 0, level: "basic"};
+for (var field in defaults) {
+  var filter = {};
+  filter[field] = {$exists: false};
+  var update = {$set: {}};
+  update.$set[field] = defaults[field];
+  db.std5.updateMany(filter, update);
+}
+db.getCollection("std5").insertOne({_id: ObjectId("5d92a2f0a7b11b0001a1b2c4"), name: "fourth", created_at: ISODate("2019-10-04T00:00:00Z"), active: true});
@@ -0,0 +1,2 @@
+db.std5.deleteOne({_id: ObjectId("5d92a2f0a7b11b0001a1b2c4")});
+db.std5.updateMany({}, {$unset: {score: "", level: ""}});